@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"go-crud/internal/auth"
+	"go-crud/internal/config"
+)
+
+const apiKeysUsage = `Usage: server apikeys <command> [flags]
+
+Commands:
+  create --name NAME --scopes users:read[,users:write,users:admin]
+  list
+  rotate ID
+  revoke ID
+
+create and rotate print the key once; it cannot be shown again.
+`
+
+// apiKeys manages API keys, including the first admin key, which cannot be
+// created over HTTP without one.
+func apiKeys(ctx context.Context, cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, apiKeysUsage)
+		return errUsage
+	}
+	name, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("apikeys "+name, flag.ContinueOnError)
+	var run func(ctx context.Context, store *auth.PostgresAPIKeyStore) error
+	switch name {
+	case "create":
+		keyName := fs.String("name", "", "name describing the client")
+		scopes := fs.String("scopes", auth.ScopeUsersRead, "comma-separated scopes")
+		run = func(ctx context.Context, store *auth.PostgresAPIKeyStore) error {
+			key, secret, err := store.Create(ctx, *keyName, strings.Split(*scopes, ","))
+			if err != nil {
+				return err
+			}
+			return printKey(key, secret)
+		}
+	case "list":
+		run = func(ctx context.Context, store *auth.PostgresAPIKeyStore) error {
+			keys, err := store.List(ctx)
+			if err != nil {
+				return err
+			}
+			return printJSON(keys)
+		}
+	case "rotate":
+		run = func(ctx context.Context, store *auth.PostgresAPIKeyStore) error {
+			id, err := apiKeyIDArg(fs)
+			if err != nil {
+				return err
+			}
+			key, secret, err := store.Rotate(ctx, id)
+			if err != nil {
+				return err
+			}
+			return printKey(key, secret)
+		}
+	case "revoke":
+		run = func(ctx context.Context, store *auth.PostgresAPIKeyStore) error {
+			id, err := apiKeyIDArg(fs)
+			if err != nil {
+				return err
+			}
+			if err := store.Revoke(ctx, id); err != nil {
+				return err
+			}
+			fmt.Printf("revoked %s\n", id)
+			return nil
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown apikeys command %q\n\n%s", name, apiKeysUsage)
+		return errUsage
+	}
+	if err := fs.Parse(flagsFirst(args)); err != nil {
+		return err
+	}
+
+	sqlDB, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+	return run(ctx, auth.NewPostgresAPIKeyStore(sqlDB))
+}
+
+func apiKeyIDArg(fs *flag.FlagSet) (uuid.UUID, error) {
+	if fs.NArg() != 1 {
+		return uuid.Nil, fmt.Errorf("expected exactly one API key ID, got %d arguments", fs.NArg())
+	}
+	id, err := uuid.Parse(fs.Arg(0))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid API key ID %q", fs.Arg(0))
+	}
+	return id, nil
+}
+
+func printKey(key auth.APIKey, secret string) error {
+	return printJSON(struct {
+		auth.APIKey
+		Key string `json:"key"`
+	}{key, secret})
+}
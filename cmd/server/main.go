@@ -3,66 +3,159 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	dbMigrate "go-crud/internal/db"
-	db "go-crud/internal/db/sqlc"
-	httpRouter "go-crud/internal/http"
+	"go-crud/internal/auth"
+	"go-crud/internal/config"
+	"go-crud/internal/logging"
+	"go-crud/internal/mail"
+	"go-crud/internal/tracing"
 	"go-crud/internal/user"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
+const usage = `Usage: server <command> [arguments]
+
+Commands:
+  serve                         run the HTTP API (default)
+  migrate up|down [N]|status    apply, revert or list schema migrations
+  users create|get|list|update|delete
+                                manage users directly
+  seed --count N                create N users with fake data
+  export                        write users as CSV or NDJSON
+  import FILE                   create users from a CSV or NDJSON file
+  apikeys create|list|rotate|revoke
+                                manage API keys
+
+Configuration is read from the environment; see .env.example.
+Run "server <command> -h" for the flags of a command.
+`
+
+// errUsage marks an invalid command line. The command has already explained
+// what is wrong.
+var errUsage = errors.New("usage error")
+
+var commands = map[string]func(ctx context.Context, cfg config.Config, args []string) error{
+	"serve":   serve,
+	"migrate": migrate,
+	"users":   users,
+	"seed":    seed,
+	"export":  exportUsers,
+	"import":  importUsers,
+	"apikeys": apiKeys,
+}
+
 func main() {
-	port := getEnv("APP_PORT", "8080")
-	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		getEnv("DB_HOST", "localhost"),
-		getEnv("DB_PORT", "5432"),
-		getEnv("DB_USER", "postgres"),
-		getEnv("DB_PASSWORD", "postgres"),
-		getEnv("DB_NAME", "usersdb"),
-		getEnv("DB_SSLMODE", "disable"),
-	)
-
-	sqlDB, err := sql.Open("pgx", dsn)
+	args := os.Args[1:]
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" || name == "-h" || name == "--help" {
+		fmt.Print(usage)
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		os.Exit(1)
 	}
-	defer sqlDB.Close()
+	// Logs go to stderr so that commands can write data to stdout.
+	slog.SetDefault(logging.New(os.Stderr, cfg.Logging))
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// The first SIGINT or SIGTERM cancels ctx and lets the command finish
+	// cleanly; once stop has been called, another one kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	if err := sqlDB.PingContext(ctx); err != nil {
-		log.Fatalf("failed to connect DB: %v", err)
+	err = cmd(ctx, cfg, args)
+	stop()
+	if err != nil {
+		if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// openDB connects to the configured database and waits for it to answer.
+// Statements are traced whenever a tracer provider has been set up.
+func openDB(ctx context.Context, cfg config.Config) (*sql.DB, error) {
+	connConfig, err := pgx.ParseConfig(cfg.Database.DSN())
+	if err != nil {
+		return nil, err
 	}
+	connConfig.Tracer = tracing.QueryTracer{}
+	sqlDB := stdlib.OpenDB(*connConfig)
 
-	if err := dbMigrate.Migrate(ctx, sqlDB); err != nil {
-		log.Fatalf("failed to run migration: %v", err)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to connect DB: %w", err)
 	}
+	return sqlDB, nil
+}
 
-	queries := db.New(sqlDB)
-	repo := user.NewPostgresRepository(queries)
-	svc := user.NewService(repo)
-	handler := user.NewHandler(svc)
-	router := httpRouter.NewRouter(handler)
+// openService connects to the database and builds the user service on it,
+// sending verification emails for the users it creates if sendVerification
+// is set.
+func openService(ctx context.Context, cfg config.Config, sendVerification bool) (*user.Service, *sql.DB, error) {
+	opts, err := serviceOptions(cfg, sendVerification)
+	if err != nil {
+		return nil, nil, err
+	}
+	sqlDB, err := openDB(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user.NewService(user.NewPostgresRepository(sqlDB), opts...), sqlDB, nil
+}
 
-	addr := ":" + port
-	log.Printf("server listening on %s", addr)
-	if err := http.ListenAndServe(addr, router); err != nil {
-		log.Fatal(err)
+// serviceOptions hash and check passwords as configured and, if
+// sendVerification is set, send verification emails, so that users created
+// from the command line can get the same treatment as over HTTP.
+func serviceOptions(cfg config.Config, sendVerification bool) ([]user.ServiceOption, error) {
+	opts := []user.ServiceOption{
+		user.WithPasswordHasher(auth.NewPasswordHasher(auth.Argon2Params{
+			Memory:      cfg.Password.Memory,
+			Iterations:  cfg.Password.Iterations,
+			Parallelism: cfg.Password.Parallelism,
+		})),
+		user.WithPasswordPolicy(auth.PasswordPolicy{MinLength: cfg.Password.MinLength}),
+	}
+	if !sendVerification {
+		return opts, nil
+	}
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		return nil, err
 	}
+	return append(opts, user.WithEmailVerification(mailer, cfg.Mail.VerificationURL, cfg.Mail.VerificationTTL)), nil
 }
 
-func getEnv(key, fallback string) string {
-	v := os.Getenv(key)
-	if v == "" {
-		return fallback
+func newMailer(cfg config.Mail) (mail.Mailer, error) {
+	if cfg.Transport == "smtp" {
+		return mail.NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
 	}
-	return v
+	return mail.NewFileMailer(cfg.Dir, cfg.From)
 }
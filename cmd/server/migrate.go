@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"go-crud/internal/config"
+	dbMigrate "go-crud/internal/db"
+	"go-crud/migrations"
+)
+
+func migrate(ctx context.Context, cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), "Usage: server migrate up | down [N] | status") }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	sqlDB, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	m, err := dbMigrate.NewMigrator(sqlDB, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Printf("applied %03d_%s\n", mig.Version, mig.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		n := 1
+		if fs.NArg() > 1 {
+			if n, err = strconv.Atoi(fs.Arg(1)); err != nil || n < 1 {
+				return fmt.Errorf("N must be a positive integer, got %q", fs.Arg(1))
+			}
+		}
+		reverted, err := m.Down(ctx, n)
+		for _, mig := range reverted {
+			fmt.Printf("reverted %03d_%s\n", mig.Version, mig.Name)
+		}
+		return err
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, s := range status {
+			state, appliedAt := "pending", ""
+			switch {
+			case s.Missing:
+				state = "applied, missing from build"
+			case s.Modified:
+				state = "applied, modified since"
+			case s.Applied:
+				state = "applied"
+			}
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(tw, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+		}
+		return tw.Flush()
+	default:
+		fs.Usage()
+		return errUsage
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-crud/internal/config"
+	"go-crud/internal/user"
+)
+
+// seedRepo is a user.Repository accepting every create. Methods seeding does
+// not reach are left to the nil embedded interface.
+type seedRepo struct {
+	user.Repository
+}
+
+func (r seedRepo) RunBatch(_ context.Context, n int, _ bool, fn func(tx user.Repository, i int) error) ([]error, error) {
+	errs := make([]error, n)
+	for i := range n {
+		errs[i] = fn(r, i)
+	}
+	return errs, nil
+}
+
+func (seedRepo) Create(_ context.Context, input user.CreateUserRequest) (user.User, error) {
+	return user.User{UserID: uuid.New(), FirstName: input.FirstName, Email: input.Email}, nil
+}
+
+func (seedRepo) RecordAudit(context.Context, user.AuditRecord) error {
+	return nil
+}
+
+func (seedRepo) ReplaceEmailVerification(context.Context, user.EmailVerification) error {
+	return nil
+}
+
+func TestSeedSendsNoVerificationEmails(t *testing.T) {
+	// Seeding with verification turned on shows that the mail directory
+	// would catch any email seeding sent.
+	for _, send := range []bool{false, true} {
+		dir := t.TempDir()
+		cfg := config.Config{Mail: config.Mail{
+			Transport:       "file",
+			From:            "no-reply@example.com",
+			Dir:             dir,
+			VerificationURL: "http://localhost:8080/verify-email",
+			VerificationTTL: time.Hour,
+		}}
+		opts, err := serviceOptions(cfg, send)
+		if err != nil {
+			t.Fatalf("service options: %v", err)
+		}
+
+		if _, err := seedUsers(context.Background(), user.NewService(seedRepo{}, opts...), 3); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("read mail dir: %v", err)
+		}
+		want := 0
+		if send {
+			want = 3
+		}
+		if len(entries) != want {
+			t.Fatalf("send=%v: expected %d emails, got %d", send, want, len(entries))
+		}
+	}
+}
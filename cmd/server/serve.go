@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go-crud/internal/auth"
+	"go-crud/internal/authz"
+	"go-crud/internal/config"
+	dbMigrate "go-crud/internal/db"
+	httpRouter "go-crud/internal/http"
+	"go-crud/internal/metrics"
+	"go-crud/internal/tracing"
+	"go-crud/internal/user"
+	"go-crud/migrations"
+)
+
+// serve runs the HTTP API until ctx is cancelled, then shuts down gracefully:
+// readiness fails first, in-flight requests drain within the configured
+// deadline, and the database pool closes last.
+func serve(ctx context.Context, cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("flush traces", "error", err)
+		}
+	}()
+
+	sqlDB, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	migrator, err := dbMigrate.NewMigrator(sqlDB, migrations.FS)
+	if err != nil {
+		return err
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		return err
+	}
+
+	m := metrics.New()
+	if err := m.RegisterDB(sqlDB); err != nil {
+		return err
+	}
+	repo := tracing.NewRepository(metrics.NewRepository(user.NewPostgresRepository(sqlDB), m))
+	serviceOpts, err := serviceOptions(cfg, true)
+	if err != nil {
+		return err
+	}
+	if cfg.AuthzPolicyFile != "" {
+		policy, err := authz.Load(cfg.AuthzPolicyFile)
+		if err != nil {
+			return err
+		}
+		serviceOpts = append(serviceOpts, user.WithAuthorizer(policy))
+	}
+	svc := user.NewService(repo, serviceOpts...)
+	idempotencyKeys := user.NewPostgresIdempotencyStore(sqlDB)
+	handler := user.NewHandler(svc,
+		user.WithRequireIfMatch(cfg.RequireIfMatch),
+		user.WithIdempotency(idempotencyKeys, cfg.IdempotencyKeyTTL),
+	)
+	apiKeys := auth.NewPostgresAPIKeyStore(sqlDB)
+	sessions := auth.NewPostgresSessionStore(sqlDB, cfg.SessionTTL)
+	authenticators := []auth.Authenticator{apiKeys, sessions}
+	if cfg.JWT.JWKS != "" {
+		jwks, err := auth.NewJWKS(ctx, cfg.JWT.JWKS, nil)
+		if err != nil {
+			return err
+		}
+		go jwks.Run(ctx, cfg.JWT.RefreshInterval)
+		jwtAuth, err := auth.NewJWTAuthenticator(jwks, cfg.JWT.Issuer, cfg.JWT.Audience,
+			auth.WithRolesClaim(cfg.JWT.RolesClaim),
+			auth.WithUserIDClaim(cfg.JWT.UserIDClaim),
+			auth.WithRoleScopes(cfg.JWT.RoleScopes),
+			auth.WithClockSkew(cfg.JWT.ClockSkew),
+		)
+		if err != nil {
+			return err
+		}
+		authenticators = append(authenticators, jwtAuth)
+	}
+	health := httpRouter.NewHealth(httpRouter.DatabaseCheck(sqlDB), httpRouter.MigrationCheck(migrator))
+	router := httpRouter.NewRouter(handler,
+		httpRouter.WithHealth(health),
+		httpRouter.WithMetrics(m),
+		httpRouter.WithAuth(authenticators...),
+		httpRouter.WithAPIKeyAdmin(auth.NewAPIKeyHandler(apiKeys)),
+		httpRouter.WithSessions(auth.NewSessionHandler(sessions, svc)),
+	)
+
+	go user.NewPurger(svc, cfg.SoftDeleteRetention, cfg.PurgeInterval,
+		user.WithExpiredIdempotencyKeys(idempotencyKeys),
+		user.WithExpiredSessions(sessions),
+	).Run(ctx)
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+		MaxHeaderBytes:    cfg.HTTP.MaxHeaderBytes,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", "addr", srv.Addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down: failing readiness", "delay", cfg.HTTP.ShutdownDelay.String())
+	health.Shutdown()
+	time.Sleep(cfg.HTTP.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	slog.Info("draining connections", "timeout", cfg.HTTP.ShutdownTimeout.String())
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info("server stopped")
+	return nil
+}
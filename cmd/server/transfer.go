@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-crud/internal/config"
+	"go-crud/internal/user"
+)
+
+// exportUsers writes the selected users to --output, or stdout, in the same
+// formats as GET /users/export.
+func exportUsers(ctx context.Context, cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", user.ExportCSV, "csv or ndjson")
+	columns := fs.String("columns", "", "comma-separated columns; default all")
+	header := fs.Bool("header", true, "write a CSV header row")
+	sort := fs.String("sort", "", "sort expression such as -lastName,firstName")
+	output := fs.String("output", "", "file to write; default stdout")
+	filter := filterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := user.ExportOptions{Format: *format, Header: *header}
+	var err error
+	if opts.Filter, err = filter(); err != nil {
+		return err
+	}
+	if opts.Sort, err = user.ParseSort(*sort); err != nil {
+		return err
+	}
+	if opts.Columns, err = user.ParseExportColumns(*columns); err != nil {
+		return err
+	}
+
+	svc, sqlDB, err := openService(ctx, cfg, false)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	if *output == "" {
+		w := bufio.NewWriter(os.Stdout)
+		if err := svc.Export(ctx, w, opts); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := svc.Export(ctx, f, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// importUsers creates users from a CSV or NDJSON file, or stdin when the file
+// is "-", and prints a summary followed by every row that was not created.
+func importUsers(ctx context.Context, cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "csv or ndjson; default from the file extension")
+	dryRun := fs.Bool("dry-run", false, "report what would happen without creating users")
+	actor := fs.String("actor", defaultActor(), "actor recorded in the audit log")
+	sendVerification := fs.Bool("send-verification", false, "email each created user a verification link")
+	if err := fs.Parse(flagsFirst(args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server import [flags] FILE|-")
+		return errUsage
+	}
+
+	name := fs.Arg(0)
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".csv":
+			*format = user.ImportCSV
+		case ".ndjson", ".jsonl":
+			*format = user.ImportNDJSON
+		default:
+			return fmt.Errorf("cannot infer the format of %q; pass --format", name)
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	svc, sqlDB, err := openService(ctx, cfg, *sendVerification)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	report, err := svc.Import(user.WithActor(ctx, *actor), *format, r, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, row := range report.Rows {
+		counts[row.Status]++
+		switch row.Status {
+		case user.ImportRejected:
+			fmt.Printf("row %d: rejected: %v\n", row.Row, row.Err)
+		case user.ImportSkipped:
+			fmt.Printf("row %d: skipped: %s\n", row.Row, row.Reason)
+		}
+	}
+	verb := "created"
+	if report.DryRun {
+		verb = "would create"
+	}
+	fmt.Printf("%s %d, skipped %d, rejected %d\n", verb, counts[user.ImportCreated], counts[user.ImportSkipped], counts[user.ImportRejected])
+	return nil
+}
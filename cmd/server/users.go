@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go-crud/internal/config"
+	"go-crud/internal/user"
+
+	"github.com/google/uuid"
+)
+
+const usersUsage = `Usage: server users <command> [flags]
+
+Commands:
+  create --first-name F --last-name L --email E [--phone P] [--age N] [--status S]
+  get ID
+  list [--status S] [--email-domain D] [--include-deleted] [--sort S] [--limit N] [--cursor C]
+  update ID [--version V] [--first-name F] [--last-name L] [--email E] [--phone P] [--age N] [--status S]
+  delete ID [--version V]
+
+Every command accepts --actor, recorded in the audit log.
+`
+
+func users(ctx context.Context, cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usersUsage)
+		return errUsage
+	}
+	name, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("users "+name, flag.ContinueOnError)
+	actor := fs.String("actor", defaultActor(), "actor recorded in the audit log")
+	var run func(ctx context.Context, svc *user.Service) error
+	switch name {
+	case "create":
+		run = usersCreate(fs)
+	case "get":
+		run = usersGet(fs)
+	case "list":
+		run = usersList(fs)
+	case "update":
+		run = usersUpdate(fs)
+	case "delete":
+		run = usersDelete(fs)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown users command %q\n\n%s", name, usersUsage)
+		return errUsage
+	}
+	if err := fs.Parse(flagsFirst(args)); err != nil {
+		return err
+	}
+
+	svc, sqlDB, err := openService(ctx, cfg, true)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+	return run(user.WithActor(ctx, *actor), svc)
+}
+
+func usersCreate(fs *flag.FlagSet) func(context.Context, *user.Service) error {
+	var req user.CreateUserRequest
+	fs.StringVar(&req.FirstName, "first-name", "", "first name")
+	fs.StringVar(&req.LastName, "last-name", "", "last name")
+	fs.StringVar(&req.Email, "email", "", "email address")
+	fs.StringVar(&req.Phone, "phone", "", "E.164 phone number")
+	age := fs.Int("age", 0, "age")
+	fs.StringVar(&req.Status, "status", "", "Active or Inactive")
+
+	return func(ctx context.Context, svc *user.Service) error {
+		if *age != 0 {
+			req.Age = age
+		}
+		u, err := svc.Create(ctx, req)
+		if err != nil {
+			return err
+		}
+		return printJSON(u)
+	}
+}
+
+func usersGet(fs *flag.FlagSet) func(context.Context, *user.Service) error {
+	return func(ctx context.Context, svc *user.Service) error {
+		id, err := userIDArg(fs)
+		if err != nil {
+			return err
+		}
+		u, err := svc.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		return printJSON(u)
+	}
+}
+
+func usersList(fs *flag.FlagSet) func(context.Context, *user.Service) error {
+	var opts user.ListOptions
+	filter := filterFlags(fs)
+	sort := fs.String("sort", "", "sort expression such as -lastName,firstName")
+	fs.IntVar(&opts.Page.Limit, "limit", user.DefaultPageLimit, "page size")
+	fs.StringVar(&opts.Page.Cursor, "cursor", "", "cursor from a previous page")
+
+	return func(ctx context.Context, svc *user.Service) error {
+		var err error
+		if opts.Filter, err = filter(); err != nil {
+			return err
+		}
+		if opts.Sort, err = user.ParseSort(*sort); err != nil {
+			return err
+		}
+		page, err := svc.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return printJSON(struct {
+			Items      []user.User `json:"items"`
+			NextCursor string      `json:"nextCursor,omitempty"`
+		}{page.Users, page.NextCursor})
+	}
+}
+
+func usersUpdate(fs *flag.FlagSet) func(context.Context, *user.Service) error {
+	version := fs.Int64("version", 0, "expected version; 0 skips the check")
+	firstName := fs.String("first-name", "", "first name")
+	lastName := fs.String("last-name", "", "last name")
+	email := fs.String("email", "", "email address")
+	phone := fs.String("phone", "", "E.164 phone number")
+	age := fs.Int("age", 0, "age")
+	status := fs.String("status", "", "Active or Inactive")
+
+	return func(ctx context.Context, svc *user.Service) error {
+		id, err := userIDArg(fs)
+		if err != nil {
+			return err
+		}
+
+		// Only flags given on the command line are part of the patch.
+		var req user.UpdateUserRequest
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "first-name":
+				req.FirstName = firstName
+			case "last-name":
+				req.LastName = lastName
+			case "email":
+				req.Email = email
+			case "phone":
+				req.Phone = phone
+			case "age":
+				req.Age = age
+			case "status":
+				req.Status = status
+			}
+		})
+		u, err := svc.Update(ctx, id, req, *version)
+		if err != nil {
+			return err
+		}
+		return printJSON(u)
+	}
+}
+
+func usersDelete(fs *flag.FlagSet) func(context.Context, *user.Service) error {
+	version := fs.Int64("version", 0, "expected version; 0 skips the check")
+
+	return func(ctx context.Context, svc *user.Service) error {
+		id, err := userIDArg(fs)
+		if err != nil {
+			return err
+		}
+		if err := svc.Delete(ctx, id, *version); err != nil {
+			return err
+		}
+		fmt.Printf("deleted %s\n", id)
+		return nil
+	}
+}
+
+// userIDArg returns the single positional user ID of fs.
+func userIDArg(fs *flag.FlagSet) (uuid.UUID, error) {
+	if fs.NArg() != 1 {
+		return uuid.Nil, fmt.Errorf("expected exactly one user ID, got %d arguments", fs.NArg())
+	}
+	id, err := uuid.Parse(fs.Arg(0))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid user ID %q", fs.Arg(0))
+	}
+	return id, nil
+}
+
+// flagsFirst moves a leading positional argument behind the flags, since the
+// flag package stops parsing at the first one: "update ID --email x" is
+// parsed as "update --email x ID".
+func flagsFirst(args []string) []string {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return args
+	}
+	return append(args[1:len(args):len(args)], args[0])
+}
+
+// defaultActor attributes CLI changes to the operating system user.
+func defaultActor() string {
+	if name := os.Getenv("USER"); name != "" {
+		return "cli:" + name
+	}
+	return "cli"
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// filterFlags registers the listing filter flags on fs, mirroring the query
+// parameters of GET /users, and returns a function building the filter once
+// fs has been parsed.
+func filterFlags(fs *flag.FlagSet) func() (user.Filter, error) {
+	var f user.Filter
+	fs.StringVar(&f.Status, "status", "", "only users with this status")
+	fs.StringVar(&f.EmailDomain, "email-domain", "", "only users with this email domain")
+	fs.BoolVar(&f.IncludeDeleted, "include-deleted", false, "include soft-deleted users")
+	minAge := fs.Int("min-age", -1, "only users at least this old")
+	maxAge := fs.Int("max-age", -1, "only users at most this old")
+	times := map[string]**time.Time{
+		"created-after":  &f.CreatedAfter,
+		"created-before": &f.CreatedBefore,
+		"updated-after":  &f.UpdatedAfter,
+		"updated-before": &f.UpdatedBefore,
+	}
+	values := make(map[string]*string, len(times))
+	for name := range times {
+		values[name] = fs.String(name, "", "RFC 3339 timestamp bound (exclusive)")
+	}
+
+	return func() (user.Filter, error) {
+		if *minAge >= 0 {
+			f.MinAge = minAge
+		}
+		if *maxAge >= 0 {
+			f.MaxAge = maxAge
+		}
+		for name, dst := range times {
+			if *values[name] == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, *values[name])
+			if err != nil {
+				return user.Filter{}, fmt.Errorf("--%s must be an RFC 3339 timestamp", name)
+			}
+			*dst = &t
+		}
+		return f, nil
+	}
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	db "go-crud/internal/db/sqlc"
+)
+
+// apiKeyPrefix starts every API key, so that keys are recognisable in
+// configuration and secret scanners and distinguishable from other tokens.
+const apiKeyPrefix = "gk_"
+
+// lastUsedInterval limits how often a key's last-used time is written, so
+// that busy clients do not cause a write per request.
+const lastUsedInterval = time.Minute
+
+var (
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrInvalidAPIKeyName = errors.New("api key name must be between 1 and 100 characters")
+)
+
+// APIKey describes a key without its secret, which is only returned when
+// the key is created or rotated.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RotatedAt  *time.Time `json:"rotatedAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// APIKeyStore manages API keys. Only a SHA-256 hash of each secret is
+// stored; keys are random enough that a slow hash adds nothing.
+type APIKeyStore interface {
+	Authenticator
+	// Create and Rotate return the new key in full. It cannot be read
+	// back later.
+	Create(ctx context.Context, name string, scopes []string) (APIKey, string, error)
+	List(ctx context.Context) ([]APIKey, error)
+	Rotate(ctx context.Context, id uuid.UUID) (APIKey, string, error)
+	Revoke(ctx context.Context, id uuid.UUID) error
+}
+
+type PostgresAPIKeyStore struct {
+	q *db.Queries
+}
+
+func NewPostgresAPIKeyStore(conn *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{q: db.New(conn)}
+}
+
+func (s *PostgresAPIKeyStore) Create(ctx context.Context, name string, scopes []string) (APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return APIKey{}, "", ErrInvalidAPIKeyName
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return APIKey{}, "", err
+	}
+	prefix, secret, key, err := newAPIKey()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	row, err := s.q.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		Name:       name,
+		Prefix:     prefix,
+		SecretHash: hashSecret(secret),
+		Scopes:     strings.Join(scopes, " "),
+	})
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	return apiKeyFromRow(row), key, nil
+}
+
+func (s *PostgresAPIKeyStore) List(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.q.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]APIKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, apiKeyFromRow(row))
+	}
+	return keys, nil
+}
+
+// Rotate replaces the secret of a key, keeping its ID, name and scopes. The
+// old secret stops working immediately.
+func (s *PostgresAPIKeyStore) Rotate(ctx context.Context, id uuid.UUID) (APIKey, string, error) {
+	prefix, secret, key, err := newAPIKey()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	row, err := s.q.RotateAPIKey(ctx, db.RotateAPIKeyParams{KeyID: id, Prefix: prefix, SecretHash: hashSecret(secret)})
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, "", ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	return apiKeyFromRow(row), key, nil
+}
+
+func (s *PostgresAPIKeyStore) Revoke(ctx context.Context, id uuid.UUID) error {
+	n, err := s.q.RevokeAPIKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate accepts keys of the form gk_<prefix>_<secret>.
+func (s *PostgresAPIKeyStore) Authenticate(ctx context.Context, token string) (Principal, error) {
+	prefix, secret, ok := parseAPIKey(token)
+	if !ok {
+		return Principal{}, ErrUnsupportedToken
+	}
+	row, err := s.q.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Principal{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	if row.RevokedAt.Valid || subtle.ConstantTimeCompare(row.SecretHash, hashSecret(secret)) != 1 {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	if err := s.q.TouchAPIKey(ctx, db.TouchAPIKeyParams{KeyID: row.KeyID, UsedBefore: time.Now().Add(-lastUsedInterval)}); err != nil {
+		return Principal{}, err
+	}
+	key := apiKeyFromRow(row)
+	return Principal{Subject: "apikey:" + key.ID.String(), Name: key.Name, Scopes: key.Scopes}, nil
+}
+
+// newAPIKey generates a lookup prefix and a secret, and the key combining
+// them.
+func newAPIKey() (prefix, secret, key string, err error) {
+	b := make([]byte, 6+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", fmt.Errorf("generate api key: %w", err)
+	}
+	prefix = hex.EncodeToString(b[:6])
+	secret = base64.RawURLEncoding.EncodeToString(b[6:])
+	return prefix, secret, apiKeyPrefix + prefix + "_" + secret, nil
+}
+
+func parseAPIKey(key string) (prefix, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	prefix, secret, ok = strings.Cut(rest, "_")
+	return prefix, secret, ok && prefix != "" && secret != ""
+}
+
+func hashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+func apiKeyFromRow(row db.ApiKey) APIKey {
+	return APIKey{
+		ID:         row.KeyID,
+		Name:       row.Name,
+		Prefix:     row.Prefix,
+		Scopes:     strings.Fields(row.Scopes),
+		CreatedAt:  row.CreatedAt,
+		RotatedAt:  nullTime(row.RotatedAt),
+		LastUsedAt: nullTime(row.LastUsedAt),
+		RevokedAt:  nullTime(row.RevokedAt),
+	}
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
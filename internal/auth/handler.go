@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"go-crud/internal/problem"
+)
+
+// APIKeyHandler serves the admin endpoints managing API keys. The router
+// restricts them to principals with the users:admin scope.
+type APIKeyHandler struct {
+	store APIKeyStore
+}
+
+func NewAPIKeyHandler(store APIKeyStore) *APIKeyHandler {
+	return &APIKeyHandler{store: store}
+}
+
+func (h *APIKeyHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/admin/api-keys", h.Create)
+	r.Get("/admin/api-keys", h.List)
+	r.Post("/admin/api-keys/{id}/rotate", h.Rotate)
+	r.Delete("/admin/api-keys/{id}", h.Revoke)
+}
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// apiKeyWithSecret is returned by create and rotate; Key is shown only once.
+type apiKeyWithSecret struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type listAPIKeysResponse struct {
+	Items []APIKey `json:"items"`
+}
+
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "invalid JSON payload"))
+		return
+	}
+	key, secret, err := h.store.Create(r.Context(), req.Name, req.Scopes)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, apiKeyWithSecret{APIKey: key, Key: secret})
+}
+
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.store.List(r.Context())
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, listAPIKeysResponse{Items: keys})
+}
+
+func (h *APIKeyHandler) Rotate(w http.ResponseWriter, r *http.Request) {
+	id, ok := keyID(w, r)
+	if !ok {
+		return
+	}
+	key, secret, err := h.store.Rotate(r.Context(), id)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiKeyWithSecret{APIKey: key, Key: secret})
+}
+
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	id, ok := keyID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.store.Revoke(r.Context(), id); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func keyID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "invalid api key id"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func (h *APIKeyHandler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrAPIKeyNotFound):
+		problem.Write(w, r, problem.New(http.StatusNotFound, err.Error()))
+	case errors.Is(err, ErrInvalidScope), errors.Is(err, ErrInvalidAPIKeyName):
+		problem.Write(w, r, problem.New(http.StatusBadRequest, err.Error()))
+	default:
+		internalError(w, r, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signature algorithms accepted in JWTs. Each is tied to one key type, so a
+// token cannot choose how its signature is checked.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// minRSAKeyBits rejects RSA keys too short to be trusted.
+const minRSAKeyBits = 2048
+
+// missRefreshInterval limits how often a token signed with an unknown key ID
+// triggers an early refresh, so that forged key IDs cannot flood the source.
+const missRefreshInterval = time.Minute
+
+// maxJWKSSize bounds the key set document.
+const maxJWKSSize = 1 << 20
+
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// jwk is a JSON Web Key as defined by RFC 7517, with the members of the key
+// types the verifier supports.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// verificationKey is a public key and the one algorithm it verifies.
+type verificationKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// JWKS is a JSON Web Key Set read from a file or an HTTP(S) URL. Keys are
+// cached in memory; Run refreshes them periodically, and a lookup for an
+// unknown key ID refreshes them early, at most once a minute, so that keys
+// rotated in at the identity provider are picked up promptly.
+type JWKS struct {
+	source string
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]verificationKey
+	lastAttempt time.Time
+}
+
+// NewJWKS loads the key set at source, a file path or an http:// or https://
+// URL, failing if it cannot be read or holds no usable key.
+func NewJWKS(ctx context.Context, source string, client *http.Client) (*JWKS, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	s := &JWKS{source: source, client: client}
+	if err := s.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Refresh reloads the key set, keeping the cached keys if that fails.
+func (s *JWKS) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	s.lastAttempt = time.Now()
+	s.mu.Unlock()
+
+	data, err := s.read(ctx)
+	if err != nil {
+		return fmt.Errorf("read jwks %s: %w", s.source, err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("parse jwks %s: %w", s.source, err)
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the key set every interval until ctx is cancelled. Failures
+// are logged and the previous keys stay in use.
+func (s *JWKS) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil {
+				slog.WarnContext(ctx, "refresh jwks", "error", err)
+			}
+		}
+	}
+}
+
+// key returns the key with the given ID, refreshing once if it is unknown.
+// An empty kid matches the only key of a single-key set.
+func (s *JWKS) key(ctx context.Context, kid string) (verificationKey, error) {
+	if k, ok := s.lookup(kid); ok {
+		return k, nil
+	}
+
+	s.mu.Lock()
+	due := time.Since(s.lastAttempt) >= missRefreshInterval
+	if due {
+		s.lastAttempt = time.Now()
+	}
+	s.mu.Unlock()
+	if due {
+		if err := s.Refresh(ctx); err != nil {
+			slog.WarnContext(ctx, "refresh jwks", "error", err)
+		}
+		if k, ok := s.lookup(kid); ok {
+			return k, nil
+		}
+	}
+	return verificationKey{}, fmt.Errorf("%w: kid %q", ErrKeyNotFound, kid)
+}
+
+func (s *JWKS) lookup(kid string) (verificationKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+func (s *JWKS) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return os.ReadFile(s.source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// parseJWKS decodes a key set, skipping keys that are not for signatures or
+// of an unsupported type so that a provider publishing extra keys still
+// works. It fails if no key is usable.
+func parseJWKS(data []byte) (map[string]verificationKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		vk, err := k.verificationKey()
+		if err != nil {
+			slog.Warn("skip jwk", "kid", k.Kid, "error", err)
+			continue
+		}
+		if _, dup := keys[k.Kid]; dup {
+			return nil, fmt.Errorf("duplicate kid %q", k.Kid)
+		}
+		keys[k.Kid] = vk
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) verificationKey() (verificationKey, error) {
+	var vk verificationKey
+	switch {
+	case k.Kty == "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return vk, fmt.Errorf("n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return vk, errors.New("invalid exponent")
+		}
+		if n.BitLen() < minRSAKeyBits {
+			return vk, fmt.Errorf("rsa key shorter than %d bits", minRSAKeyBits)
+		}
+		vk = verificationKey{alg: AlgRS256, key: &rsa.PublicKey{N: n, E: int(e.Int64())}}
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return vk, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return vk, fmt.Errorf("y: %w", err)
+		}
+		if x.BitLen() > 256 || y.BitLen() > 256 {
+			return vk, errors.New("invalid P-256 point")
+		}
+		// ecdh checks that the point lies on the curve.
+		point := append([]byte{4}, append(x.FillBytes(make([]byte, 32)), y.FillBytes(make([]byte, 32))...)...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return vk, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		vk = verificationKey{alg: AlgES256, key: pub}
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return vk, errors.New("invalid Ed25519 key")
+		}
+		vk = verificationKey{alg: AlgEdDSA, key: ed25519.PublicKey(x)}
+	default:
+		return vk, fmt.Errorf("unsupported key type %s %s", k.Kty, k.Crv)
+	}
+	if k.Alg != "" && k.Alg != vk.alg {
+		return vk, fmt.Errorf("alg %s does not match key type %s", k.Alg, k.Kty)
+	}
+	return vk, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
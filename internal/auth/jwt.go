@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Claims read unless WithRolesClaim or WithUserIDClaim say otherwise.
+const (
+	DefaultRolesClaim  = "roles"
+	DefaultUserIDClaim = "sub"
+)
+
+// JWTAuthenticator validates JWTs issued by a single identity provider and
+// signed with a key from its JWKS. Tokens must name the configured issuer
+// and audience, carry exp and sub, and be within exp and nbf allowing for
+// clock skew. The principal's roles come from the roles claim and its user
+// ID from the user ID claim; its scopes are the known scopes in the scope
+// claim plus those granted to its roles.
+type JWTAuthenticator struct {
+	keys        *JWKS
+	issuer      string
+	audience    string
+	rolesClaim  string
+	userIDClaim string
+	roleScopes  map[string]string
+	clockSkew   time.Duration
+	now         func() time.Time
+}
+
+type JWTOption func(*JWTAuthenticator)
+
+// WithRolesClaim reads roles from claim, which may be a dotted path into
+// nested objects such as "realm_access.roles".
+func WithRolesClaim(claim string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.rolesClaim = claim
+	}
+}
+
+// WithUserIDClaim reads the ID of the principal's own user record from
+// claim, which may be a dotted path like WithRolesClaim's.
+func WithUserIDClaim(claim string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.userIDClaim = claim
+	}
+}
+
+// WithRoleScopes grants each role the mapped scope.
+func WithRoleScopes(roleScopes map[string]string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.roleScopes = roleScopes
+	}
+}
+
+// WithClockSkew tolerates clocks differing from the issuer's by up to d.
+func WithClockSkew(d time.Duration) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.clockSkew = d
+	}
+}
+
+func NewJWTAuthenticator(keys *JWKS, issuer, audience string, opts ...JWTOption) (*JWTAuthenticator, error) {
+	if issuer == "" || audience == "" {
+		return nil, errors.New("jwt issuer and audience are required")
+	}
+	a := &JWTAuthenticator{
+		keys:        keys,
+		issuer:      issuer,
+		audience:    audience,
+		rolesClaim:  DefaultRolesClaim,
+		userIDClaim: DefaultUserIDClaim,
+		clockSkew:   30 * time.Second,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	for role, scope := range a.roleScopes {
+		if !slices.Contains(AllScopes, scope) {
+			return nil, fmt.Errorf("%w: %q for role %q", ErrInvalidScope, scope, role)
+		}
+	}
+	return a, nil
+}
+
+type jwtHeader struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid"`
+	Typ  string   `json:"typ"`
+	Crit []string `json:"crit"`
+}
+
+// Authenticate fails with ErrUnsupportedToken unless token is shaped like a
+// JWS in compact form, so that other bearer tokens fall through to the next
+// authenticator.
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, ErrUnsupportedToken
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg == "" {
+		return Principal{}, ErrUnsupportedToken
+	}
+
+	if err := a.verify(ctx, header, parts); err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, fmt.Errorf("%w: claims: %w", ErrInvalidCredentials, err)
+	}
+	p, err := a.principal(claims)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	return p, nil
+}
+
+// verify checks the signature with the key named by kid, which must be of
+// the type the header's alg calls for.
+func (a *JWTAuthenticator) verify(ctx context.Context, header jwtHeader, parts []string) error {
+	if len(header.Crit) > 0 {
+		return fmt.Errorf("unsupported critical headers %v", header.Crit)
+	}
+	if header.Typ != "" && !strings.EqualFold(header.Typ, "JWT") && !strings.EqualFold(header.Typ, "at+jwt") {
+		return fmt.Errorf("unexpected typ %q", header.Typ)
+	}
+	if header.Alg != AlgRS256 && header.Alg != AlgES256 && header.Alg != AlgEdDSA {
+		return fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+	key, err := a.keys.key(ctx, header.Kid)
+	if err != nil {
+		return err
+	}
+	if key.alg != header.Alg {
+		return fmt.Errorf("alg %s does not match key %q", header.Alg, header.Kid)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(signed)
+	var ok bool
+	switch pub := key.key.(type) {
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		// JWS encodes ES256 signatures as r || s, 32 bytes each.
+		if len(sig) == 64 {
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			ok = ecdsa.Verify(pub, digest[:], r, s)
+		}
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, signed, sig)
+	}
+	if !ok {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// principal validates the registered claims and maps the rest to a
+// principal.
+func (a *JWTAuthenticator) principal(claims map[string]any) (Principal, error) {
+	if iss, _ := claims["iss"].(string); iss != a.issuer {
+		return Principal{}, fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if !audienceContains(claims["aud"], a.audience) {
+		return Principal{}, errors.New("token is not for this audience")
+	}
+
+	now := a.now()
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return Principal{}, errors.New("missing exp")
+	}
+	if !now.Before(exp.Add(a.clockSkew)) {
+		return Principal{}, errors.New("token expired")
+	}
+	if _, present := claims["nbf"]; present {
+		nbf, ok := numericDate(claims["nbf"])
+		if !ok {
+			return Principal{}, errors.New("invalid nbf")
+		}
+		if now.Add(a.clockSkew).Before(nbf) {
+			return Principal{}, errors.New("token not yet valid")
+		}
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return Principal{}, errors.New("missing sub")
+	}
+	p := Principal{Subject: "jwt:" + sub, Name: sub}
+	for _, claim := range []string{"name", "preferred_username"} {
+		if name, _ := claims[claim].(string); name != "" {
+			p.Name = name
+			break
+		}
+	}
+
+	p.UserID, _ = lookupClaim(claims, a.userIDClaim).(string)
+	p.Roles = stringList(lookupClaim(claims, a.rolesClaim))
+	for _, s := range stringList(claims["scope"]) {
+		if slices.Contains(AllScopes, s) && !slices.Contains(p.Scopes, s) {
+			p.Scopes = append(p.Scopes, s)
+		}
+	}
+	for _, role := range p.Roles {
+		if s, ok := a.roleScopes[role]; ok && !slices.Contains(p.Scopes, s) {
+			p.Scopes = append(p.Scopes, s)
+		}
+	}
+	return p, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// audienceContains reports whether aud, a string or an array of strings,
+// names want.
+func audienceContains(aud any, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []any:
+		return slices.Contains(aud, any(want))
+	}
+	return false
+}
+
+// numericDate converts a NumericDate claim, seconds since the epoch with an
+// optional fraction, to a time.
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, 0).Add(time.Duration(f * float64(time.Second))), true
+}
+
+// lookupClaim follows a dotted path through nested claim objects.
+func lookupClaim(claims map[string]any, path string) any {
+	var v any = claims
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// stringList reads a claim holding either an array of strings or a single
+// space-separated string, as OAuth 2.0 uses for scope.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,347 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "go-crud"
+)
+
+// testKey is a locally generated signing key and its public JWK.
+type testKey struct {
+	kid    string
+	alg    string
+	signer crypto.Signer
+}
+
+func newTestKeys(t *testing.T) []testKey {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ec key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	return []testKey{
+		{kid: "rsa-1", alg: AlgRS256, signer: rsaKey},
+		{kid: "ec-1", alg: AlgES256, signer: ecKey},
+		{kid: "ed-1", alg: AlgEdDSA, signer: edKey},
+	}
+}
+
+func (k testKey) jwk() map[string]string {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch pub := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": k.kid, "use": "sig", "n": enc(pub.N.Bytes()), "e": enc([]byte{1, 0, 1})}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": k.kid, "crv": "P-256", "x": enc(pub.X.FillBytes(make([]byte, 32))), "y": enc(pub.Y.FillBytes(make([]byte, 32)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": k.kid, "crv": "Ed25519", "x": enc(pub)}
+	}
+	panic("unsupported key")
+}
+
+func jwksDocument(t *testing.T, keys ...testKey) []byte {
+	t.Helper()
+	set := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, k.jwk())
+	}
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("marshal jwks: %v", err)
+	}
+	return b
+}
+
+// sign issues a compact JWS over claims with the header alg, which tests may
+// set to something other than the key's algorithm.
+func (k testKey) sign(t *testing.T, alg string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": k.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	var err error
+	switch key := k.signer.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, signErr := ecdsa.Sign(rand.Reader, key, digest[:])
+		sig, err = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), signErr
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, []byte(input))
+	}
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims(now time.Time) map[string]any {
+	return map[string]any{
+		"iss":   testIssuer,
+		"aud":   []string{"other", testAudience},
+		"sub":   "user-42",
+		"name":  "Ada Lovelace",
+		"exp":   now.Add(time.Hour).Unix(),
+		"nbf":   now.Add(-time.Minute).Unix(),
+		"roles": []string{"support", "auditor"},
+		"scope": "openid users:write",
+	}
+}
+
+func newTestAuthenticator(t *testing.T, now time.Time, keys ...testKey) *JWTAuthenticator {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksDocument(t, keys...), 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+	jwks, err := NewJWKS(context.Background(), path, nil)
+	if err != nil {
+		t.Fatalf("load jwks: %v", err)
+	}
+	a, err := NewJWTAuthenticator(jwks, testIssuer, testAudience,
+		WithRoleScopes(map[string]string{"support": ScopeUsersRead, "admin": ScopeUsersAdmin}),
+	)
+	if err != nil {
+		t.Fatalf("new authenticator: %v", err)
+	}
+	a.now = func() time.Time { return now }
+	return a
+}
+
+func TestJWTAuthenticatorAcceptsEachAlgorithm(t *testing.T) {
+	now := time.Now()
+	keys := newTestKeys(t)
+	a := newTestAuthenticator(t, now, keys...)
+
+	for _, k := range keys {
+		p, err := a.Authenticate(context.Background(), k.sign(t, k.alg, validClaims(now)))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", k.alg, err)
+		}
+		if p.Subject != "jwt:user-42" || p.Name != "Ada Lovelace" || p.Actor() != "jwt:user-42" || p.UserID != "user-42" {
+			t.Fatalf("%s: unexpected principal %+v", k.alg, p)
+		}
+		if !slices.Equal(p.Roles, []string{"support", "auditor"}) {
+			t.Fatalf("%s: unexpected roles %v", k.alg, p.Roles)
+		}
+		if !slices.Equal(p.Scopes, []string{ScopeUsersWrite, ScopeUsersRead}) {
+			t.Fatalf("%s: unexpected scopes %v", k.alg, p.Scopes)
+		}
+	}
+}
+
+func TestJWTAuthenticatorRejectsInvalidTokens(t *testing.T) {
+	now := time.Now()
+	keys := newTestKeys(t)
+	rsaKey, ecKey := keys[0], keys[1]
+	a := newTestAuthenticator(t, now, keys...)
+
+	with := func(key string, v any) map[string]any {
+		c := validClaims(now)
+		if v == nil {
+			delete(c, key)
+		} else {
+			c[key] = v
+		}
+		return c
+	}
+	rogue := newTestKeys(t)[0]
+	tamperedPayload := func() string {
+		parts := strings.Split(rsaKey.sign(t, AlgRS256, validClaims(now)), ".")
+		forged, _ := json.Marshal(with("roles", []string{"admin"}))
+		return parts[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." + parts[2]
+	}
+
+	tests := map[string]string{
+		"wrong issuer":       rsaKey.sign(t, AlgRS256, with("iss", "https://evil.example.com")),
+		"wrong audience":     rsaKey.sign(t, AlgRS256, with("aud", "another-api")),
+		"missing audience":   rsaKey.sign(t, AlgRS256, with("aud", nil)),
+		"expired":            rsaKey.sign(t, AlgRS256, with("exp", now.Add(-time.Minute).Unix())),
+		"missing exp":        rsaKey.sign(t, AlgRS256, with("exp", nil)),
+		"not yet valid":      rsaKey.sign(t, AlgRS256, with("nbf", now.Add(time.Minute).Unix())),
+		"missing sub":        rsaKey.sign(t, AlgRS256, with("sub", nil)),
+		"unknown key":        rogue.sign(t, AlgRS256, validClaims(now)),
+		"tampered payload":   tamperedPayload(),
+		"alg mismatch":       ecKey.sign(t, AlgRS256, validClaims(now)),
+		"alg none":           strings.Join(strings.Split(rsaKey.sign(t, "none", validClaims(now)), ".")[:2], ".") + ".",
+		"unsupported alg":    rsaKey.sign(t, "HS256", validClaims(now)),
+		"undecodable claims": strings.Replace(rsaKey.sign(t, AlgRS256, validClaims(now)), ".", ".!", 1),
+	}
+	for name, token := range tests {
+		if _, err := a.Authenticate(context.Background(), token); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%s: expected ErrInvalidCredentials, got %v", name, err)
+		}
+	}
+}
+
+func TestJWTAuthenticatorAllowsClockSkew(t *testing.T) {
+	now := time.Now()
+	k := newTestKeys(t)[2]
+	a := newTestAuthenticator(t, now, k)
+
+	c := validClaims(now)
+	c["exp"] = now.Add(-10 * time.Second).Unix()
+	c["nbf"] = now.Add(10 * time.Second).Unix()
+	if _, err := a.Authenticate(context.Background(), k.sign(t, k.alg, c)); err != nil {
+		t.Fatalf("expected token within the default skew to be accepted, got %v", err)
+	}
+}
+
+func TestJWTAuthenticatorIgnoresOtherTokens(t *testing.T) {
+	a := newTestAuthenticator(t, time.Now(), newTestKeys(t)[0])
+	for _, token := range []string{"gk_0123456789ab_secret", "a.b", "not.a.jwt"} {
+		if _, err := a.Authenticate(context.Background(), token); !errors.Is(err, ErrUnsupportedToken) {
+			t.Fatalf("%q: expected ErrUnsupportedToken, got %v", token, err)
+		}
+	}
+}
+
+func TestJWTAuthenticatorReadsNestedRolesClaim(t *testing.T) {
+	now := time.Now()
+	k := newTestKeys(t)[1]
+	a := newTestAuthenticator(t, now, k)
+	WithRolesClaim("realm_access.roles")(a)
+
+	c := validClaims(now)
+	delete(c, "scope")
+	c["realm_access"] = map[string]any{"roles": []string{"admin"}}
+	p, err := a.Authenticate(context.Background(), k.sign(t, k.alg, c))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(p.Roles, []string{"admin"}) || !p.HasScope(ScopeUsersAdmin) {
+		t.Fatalf("unexpected principal %+v", p)
+	}
+}
+
+func TestNewJWTAuthenticatorRejectsUnknownScope(t *testing.T) {
+	_, err := NewJWTAuthenticator(&JWKS{}, testIssuer, testAudience, WithRoleScopes(map[string]string{"ops": "users:everything"}))
+	if !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected ErrInvalidScope, got %v", err)
+	}
+}
+
+func TestJWKSRefreshesFromURL(t *testing.T) {
+	now := time.Now()
+	keys := newTestKeys(t)
+	var current atomic.Value
+	current.Store(jwksDocument(t, keys[0]))
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(current.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	jwks, err := NewJWKS(ctx, srv.URL, srv.Client())
+	if err != nil {
+		t.Fatalf("load jwks: %v", err)
+	}
+	a, err := NewJWTAuthenticator(jwks, testIssuer, testAudience)
+	if err != nil {
+		t.Fatalf("new authenticator: %v", err)
+	}
+	a.now = func() time.Time { return now }
+
+	// A key rotated in at the provider is not fetched again straight
+	// after loading...
+	current.Store(jwksDocument(t, keys...))
+	rotated := keys[2].sign(t, keys[2].alg, validClaims(now))
+	if _, err := a.Authenticate(ctx, rotated); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected unknown key to be rejected before refresh, got %v", err)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("expected the miss not to refetch within a minute, got %d fetches", n)
+	}
+
+	// ...but is picked up by a refresh, or by a miss once the rate limit
+	// allows.
+	if err := jwks.Refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if _, err := a.Authenticate(ctx, rotated); err != nil {
+		t.Fatalf("expected rotated key to be accepted after refresh, got %v", err)
+	}
+
+	current.Store([]byte(`{"keys": []}`))
+	if err := jwks.Refresh(ctx); err == nil {
+		t.Fatal("expected an empty key set to be rejected")
+	}
+	if _, err := a.Authenticate(ctx, rotated); err != nil {
+		t.Fatalf("expected cached keys to survive a failed refresh, got %v", err)
+	}
+
+	jwks.mu.Lock()
+	jwks.lastAttempt = time.Time{}
+	jwks.mu.Unlock()
+	current.Store(jwksDocument(t, keys...))
+	other := keys[1].sign(t, keys[1].alg, validClaims(now))
+	jwks.mu.Lock()
+	delete(jwks.keys, keys[1].kid)
+	jwks.mu.Unlock()
+	if _, err := a.Authenticate(ctx, other); err != nil {
+		t.Fatalf("expected a miss to refresh the key set, got %v", err)
+	}
+}
+
+func TestParseJWKSSkipsUnusableKeys(t *testing.T) {
+	keys := newTestKeys(t)
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	doc, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		keys[0].jwk(),
+		{"kty": "RSA", "kid": "short", "n": enc(small.N.Bytes()), "e": "AQAB"},
+		{"kty": "EC", "kid": "off-curve", "crv": "P-256", "x": enc(make([]byte, 32)), "y": enc([]byte{1})},
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		{"kty": "OKP", "kid": "enc", "use": "enc", "crv": "Ed25519", "x": keys[2].jwk()["x"]},
+		{"kty": "OKP", "kid": "wrong-alg", "alg": "RS256", "crv": "Ed25519", "x": keys[2].jwk()["x"]},
+	}})
+
+	got, err := parseJWKS(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got["rsa-1"].alg != AlgRS256 {
+		t.Fatalf("expected only rsa-1, got %v", got)
+	}
+}
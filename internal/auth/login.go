@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"go-crud/internal/problem"
+)
+
+const problemTypeUnauthenticated = "/problems/unauthenticated"
+
+// PasswordChecker verifies a user's password and returns the user's ID. It
+// fails with ErrInvalidCredentials alike for unknown emails, wrong
+// passwords and users who may not sign in, so that responses do not reveal
+// which accounts exist.
+type PasswordChecker interface {
+	CheckPassword(ctx context.Context, email, password string) (uuid.UUID, error)
+}
+
+// SessionHandler serves sign-in and sign-out. Both endpoints are open: login
+// takes a password and logout the session token being ended.
+type SessionHandler struct {
+	sessions  SessionStore
+	passwords PasswordChecker
+}
+
+func NewSessionHandler(sessions SessionStore, passwords PasswordChecker) *SessionHandler {
+	return &SessionHandler{sessions: sessions, passwords: passwords}
+}
+
+func (h *SessionHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/auth/login", h.Login)
+	r.Post("/auth/logout", h.Logout)
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (h *SessionHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "invalid JSON payload"))
+		return
+	}
+	if req.Email == "" || req.Password == "" {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "email and password are required"))
+		return
+	}
+
+	ctx := r.Context()
+	userID, err := h.passwords.CheckPassword(ctx, req.Email, req.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		slog.DebugContext(ctx, "login failed", "error", err)
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "invalid email or password").WithCode(problemTypeUnauthenticated, "invalid_credentials"))
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	session, err := h.sessions.Create(ctx, userID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, session)
+}
+
+// Logout ends the session whose token is in the Authorization header. It
+// succeeds for tokens that have already expired or been revoked.
+func (h *SessionHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="go-crud"`)
+		problem.Write(w, r, problem.New(http.StatusUnauthorized, "missing bearer token").WithCode(problemTypeUnauthenticated, "unauthenticated"))
+		return
+	}
+	err := h.sessions.Revoke(r.Context(), token)
+	if errors.Is(err, ErrUnsupportedToken) {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, "only session tokens can be logged out"))
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func internalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "request failed", "status", http.StatusInternalServerError, "error", err.Error())
+	problem.Write(w, r, problem.New(http.StatusInternalServerError, "internal server error"))
+}
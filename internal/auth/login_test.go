@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type fakeSessions struct {
+	created []uuid.UUID
+	revoked []string
+}
+
+func (f *fakeSessions) Authenticate(context.Context, string) (Principal, error) {
+	return Principal{}, ErrUnsupportedToken
+}
+
+func (f *fakeSessions) Create(_ context.Context, userID uuid.UUID) (Session, error) {
+	f.created = append(f.created, userID)
+	return Session{Token: sessionTokenPrefix + "secret", TokenType: "Bearer", UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}, nil
+}
+
+func (f *fakeSessions) Revoke(_ context.Context, token string) error {
+	if !strings.HasPrefix(token, sessionTokenPrefix) {
+		return ErrUnsupportedToken
+	}
+	f.revoked = append(f.revoked, token)
+	return nil
+}
+
+func (f *fakeSessions) PurgeExpired(context.Context) (int64, error) { return 0, nil }
+
+type passwordCheckerFunc func(ctx context.Context, email, password string) (uuid.UUID, error)
+
+func (f passwordCheckerFunc) CheckPassword(ctx context.Context, email, password string) (uuid.UUID, error) {
+	return f(ctx, email, password)
+}
+
+func newSessionRouter(sessions SessionStore, id uuid.UUID) http.Handler {
+	r := chi.NewRouter()
+	NewSessionHandler(sessions, passwordCheckerFunc(func(_ context.Context, email, password string) (uuid.UUID, error) {
+		switch {
+		case email == "down@example.com":
+			return uuid.Nil, errors.New("database is down")
+		case email != "ada@example.com" || password != "correct horse battery":
+			return uuid.Nil, ErrInvalidCredentials
+		}
+		return id, nil
+	})).RegisterRoutes(r)
+	return r
+}
+
+func TestLogin(t *testing.T) {
+	id := uuid.New()
+	sessions := &fakeSessions{}
+	router := newSessionRouter(sessions, id)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"success", `{"email": "ada@example.com", "password": "correct horse battery"}`, http.StatusOK, ""},
+		{"wrong password", `{"email": "ada@example.com", "password": "nope"}`, http.StatusUnauthorized, "invalid_credentials"},
+		{"unknown email", `{"email": "bob@example.com", "password": "correct horse battery"}`, http.StatusUnauthorized, "invalid_credentials"},
+		{"missing password", `{"email": "ada@example.com"}`, http.StatusBadRequest, ""},
+		{"invalid JSON", `{`, http.StatusBadRequest, ""},
+		{"store failure", `{"email": "down@example.com", "password": "x"}`, http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.code != "" && !strings.Contains(rec.Body.String(), `"code":"`+tt.code+`"`) {
+				t.Fatalf("expected code %s, got %s", tt.code, rec.Body.String())
+			}
+		})
+	}
+
+	if len(sessions.created) != 1 || sessions.created[0] != id {
+		t.Fatalf("expected one session for %s, got %v", id, sessions.created)
+	}
+}
+
+func TestLoginReturnsSession(t *testing.T) {
+	id := uuid.New()
+	rec := httptest.NewRecorder()
+	body := `{"email": "ada@example.com", "password": "correct horse battery"}`
+	newSessionRouter(&fakeSessions{}, id).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body)))
+
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected Cache-Control no-store, got %q", rec.Header().Get("Cache-Control"))
+	}
+	var session Session
+	if err := json.NewDecoder(rec.Body).Decode(&session); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !strings.HasPrefix(session.Token, sessionTokenPrefix) || session.TokenType != "Bearer" || session.UserID != id {
+		t.Fatalf("unexpected session %+v", session)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	sessions := &fakeSessions{}
+	router := newSessionRouter(sessions, uuid.New())
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"session token", "Bearer gs_secret", http.StatusNoContent},
+		{"api key", "Bearer gk_abc_def", http.StatusBadRequest},
+		{"no token", "", http.StatusUnauthorized},
+		{"basic auth", "Basic YWRhOnB3", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if len(sessions.revoked) != 1 || sessions.revoked[0] != "gs_secret" {
+		t.Fatalf("expected the session token to be revoked, got %v", sessions.revoked)
+	}
+}
+
+func TestSessionAuthenticateIgnoresOtherTokens(t *testing.T) {
+	s := &PostgresSessionStore{}
+	for _, token := range []string{"", "gs_", "gk_abc_def", "eyJhbGciOi.x.y"} {
+		if _, err := s.Authenticate(context.Background(), token); !errors.Is(err, ErrUnsupportedToken) {
+			t.Fatalf("%q: expected ErrUnsupportedToken, got %v", token, err)
+		}
+	}
+}
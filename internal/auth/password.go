@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+)
+
+var (
+	ErrWeakPassword = errors.New("password is too weak")
+	// ErrMalformedHash means a stored hash is not an argon2id PHC string.
+	ErrMalformedHash = errors.New("malformed password hash")
+)
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2Params follow the OWASP recommendation for argon2id.
+var DefaultArgon2Params = Argon2Params{Memory: 19 * 1024, Iterations: 2, Parallelism: 1}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordHasher hashes passwords with argon2id, encoding the parameters
+// with each hash so that hashes made under older parameters still verify.
+type PasswordHasher struct {
+	params Argon2Params
+}
+
+func NewPasswordHasher(params Argon2Params) *PasswordHasher {
+	return &PasswordHasher{params: params}
+}
+
+// Hash returns password's hash as a PHC string such as
+// "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>".
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := h.params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLength)
+	enc := base64.RawStdEncoding.EncodeToString
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism, enc(salt), enc(key)), nil
+}
+
+// Verify reports whether password matches encoded and, if so, whether
+// encoded was made with other parameters and should be replaced by a fresh
+// Hash.
+func (h *PasswordHasher) Verify(password, encoded string) (ok, rehash bool, err error) {
+	params, salt, key, err := decodeHash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	got := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return false, false, nil
+	}
+	return true, params != h.params || len(key) != argon2KeyLength, nil
+}
+
+func decodeHash(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, ErrMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("%w: unsupported version", ErrMalformedHash)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("%w: %w", ErrMalformedHash, err)
+	}
+	if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+		return p, nil, nil, fmt.Errorf("%w: zero parameter", ErrMalformedHash)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("%w: salt: %w", ErrMalformedHash, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, fmt.Errorf("%w: key", ErrMalformedHash)
+	}
+	return p, salt, key, nil
+}
+
+// MaxPasswordLength bounds passwords, in bytes, so that hashing cost stays
+// predictable.
+const MaxPasswordLength = 256
+
+// commonPasswords are rejected outright however long they are.
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true, "passw0rd": true,
+	"123456789012": true, "qwertyuiop": true, "qwerty123456": true, "iloveyou": true,
+	"letmein": true, "welcome": true, "welcome123": true, "admin": true,
+	"administrator": true, "changeme": true, "trustno1": true, "correcthorsebatterystaple": true,
+}
+
+// PasswordPolicy decides whether a password is strong enough.
+type PasswordPolicy struct {
+	// MinLength is counted in characters.
+	MinLength int
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 12}
+
+// Check rejects passwords that are too short or long, that are common, that
+// are mostly one repeated character, or that contain one of personal, such
+// as the user's email address or names. Errors wrap ErrWeakPassword.
+func (p PasswordPolicy) Check(password string, personal ...string) error {
+	n := utf8.RuneCountInString(password)
+	switch {
+	case n < p.MinLength:
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, p.MinLength)
+	case len(password) > MaxPasswordLength:
+		return fmt.Errorf("%w: must be at most %d bytes", ErrWeakPassword, MaxPasswordLength)
+	case commonPasswords[strings.ToLower(password)]:
+		return fmt.Errorf("%w: too common", ErrWeakPassword)
+	}
+
+	distinct := make(map[rune]bool)
+	for _, r := range password {
+		distinct[r] = true
+	}
+	if len(distinct) < 5 {
+		return fmt.Errorf("%w: must use at least 5 different characters", ErrWeakPassword)
+	}
+
+	lower := strings.ToLower(password)
+	for _, s := range personal {
+		s = strings.ToLower(s)
+		if local, _, ok := strings.Cut(s, "@"); ok {
+			s = local
+		}
+		if len(s) >= 3 && strings.Contains(lower, s) {
+			return fmt.Errorf("%w: must not contain your name or email", ErrWeakPassword)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// cheapParams keep tests fast; they are far too weak for real use.
+var cheapParams = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestPasswordHashVerify(t *testing.T) {
+	h := NewPasswordHasher(cheapParams)
+	hash, err := h.Hash("correct horse battery")
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected encoding %q", hash)
+	}
+	if again, _ := h.Hash("correct horse battery"); again == hash {
+		t.Fatal("expected a fresh salt for every hash")
+	}
+
+	ok, rehash, err := h.Verify("correct horse battery", hash)
+	if err != nil || !ok || rehash {
+		t.Fatalf("verify: ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+	ok, _, err = h.Verify("correct horse battery!", hash)
+	if err != nil || ok {
+		t.Fatalf("expected wrong password to fail, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestPasswordVerifyRequestsRehash(t *testing.T) {
+	old, err := NewPasswordHasher(cheapParams).Hash("correct horse battery")
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	stronger := NewPasswordHasher(Argon2Params{Memory: 128, Iterations: 2, Parallelism: 1})
+	ok, rehash, err := stronger.Verify("correct horse battery", old)
+	if err != nil || !ok || !rehash {
+		t.Fatalf("expected old hash to verify and need rehash, got ok=%v rehash=%v err=%v", ok, rehash, err)
+	}
+}
+
+func TestPasswordVerifyRejectsMalformedHashes(t *testing.T) {
+	h := NewPasswordHasher(cheapParams)
+	for _, encoded := range []string{
+		"",
+		"plaintext",
+		"$2a$10$abcdefghijklmnopqrstuv",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!$a2V5a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$",
+	} {
+		if _, _, err := h.Verify("password", encoded); !errors.Is(err, ErrMalformedHash) {
+			t.Fatalf("%q: expected ErrMalformedHash, got %v", encoded, err)
+		}
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	tests := []struct {
+		password string
+		personal []string
+		ok       bool
+	}{
+		{"correct horse battery", nil, true},
+		{"short", nil, false},
+		{"Password123", nil, false},
+		{"CorrectHorseBatteryStaple", nil, false},
+		{"aaaaaaaaaaaaaaaa", nil, false},
+		{"abababcabababc", nil, false},
+		{strings.Repeat("abcdefgh", 40), nil, false},
+		{"ada.lovelace 1815!", []string{"ada.lovelace@example.com"}, false},
+		{"my name is Lovelace", []string{"ada@example.com", "Ada", "Lovelace"}, false},
+		{"Al rides at dawn", []string{"Al"}, true},
+		{"naïve café façade", nil, true},
+	}
+	for _, tt := range tests {
+		err := DefaultPasswordPolicy.Check(tt.password, tt.personal...)
+		if tt.ok && err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.password, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrWeakPassword) {
+			t.Fatalf("%q: expected ErrWeakPassword, got %v", tt.password, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Package auth authenticates API clients and describes who they are.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Scopes grant access to the user endpoints. Each scope includes the ones
+// before it: users:admin implies users:write, which implies users:read.
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+	ScopeUsersAdmin = "users:admin"
+)
+
+// AllScopes lists the scopes in increasing order of privilege.
+var AllScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeUsersAdmin}
+
+var (
+	// ErrUnsupportedToken means a token is not of the kind an
+	// Authenticator handles, so that the next one may try it.
+	ErrUnsupportedToken = errors.New("unsupported token")
+	// ErrInvalidCredentials means a token of the right kind is unknown,
+	// expired or revoked.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidScope       = errors.New("invalid scope")
+)
+
+// Principal is an authenticated client. Subject identifies it uniquely, such
+// as "apikey:<id>" or "jwt:<sub>"; Name is for display. Roles are those
+// asserted by the identity provider, and are empty for API keys. UserID is
+// the user record the principal is, if any, so that it can be given rights
+// over its own record.
+type Principal struct {
+	Subject string
+	Name    string
+	Scopes  []string
+	Roles   []string
+	UserID  string
+}
+
+// Actor names the principal in the audit log.
+func (p Principal) Actor() string {
+	return p.Subject
+}
+
+// HasScope reports whether p was granted scope or a scope implying it.
+func (p Principal) HasScope(scope string) bool {
+	want := slices.Index(AllScopes, scope)
+	for _, s := range p.Scopes {
+		if i := slices.Index(AllScopes, s); i >= 0 && i >= want {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateScopes checks that scopes is a non-empty list of known scopes.
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	for _, s := range scopes {
+		if !slices.Contains(AllScopes, s) {
+			return fmt.Errorf("%w: %q", ErrInvalidScope, s)
+		}
+	}
+	return nil
+}
+
+// Authenticator resolves a bearer token to a principal. It fails with
+// ErrUnsupportedToken for tokens it does not recognise and with
+// ErrInvalidCredentials for recognised tokens that are not valid.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (Principal, error)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal set by WithPrincipal.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHasScopeFollowsHierarchy(t *testing.T) {
+	tests := []struct {
+		granted []string
+		scope   string
+		want    bool
+	}{
+		{[]string{ScopeUsersRead}, ScopeUsersRead, true},
+		{[]string{ScopeUsersRead}, ScopeUsersWrite, false},
+		{[]string{ScopeUsersWrite}, ScopeUsersRead, true},
+		{[]string{ScopeUsersWrite}, ScopeUsersAdmin, false},
+		{[]string{ScopeUsersAdmin}, ScopeUsersWrite, true},
+		{[]string{"unknown"}, ScopeUsersRead, false},
+		{nil, ScopeUsersRead, false},
+	}
+	for _, tt := range tests {
+		if got := (Principal{Scopes: tt.granted}).HasScope(tt.scope); got != tt.want {
+			t.Fatalf("%v has %s: expected %v, got %v", tt.granted, tt.scope, tt.want, got)
+		}
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	if err := ValidateScopes([]string{ScopeUsersRead, ScopeUsersAdmin}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, scopes := range [][]string{nil, {"users:delete"}} {
+		if err := ValidateScopes(scopes); !errors.Is(err, ErrInvalidScope) {
+			t.Fatalf("%v: expected ErrInvalidScope, got %v", scopes, err)
+		}
+	}
+}
+
+func TestAPIKeyRoundTrip(t *testing.T) {
+	prefix, secret, key, err := newAPIKey()
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	gotPrefix, gotSecret, ok := parseAPIKey(key)
+	if !ok || gotPrefix != prefix || gotSecret != secret {
+		t.Fatalf("parse %q: got %q %q %v", key, gotPrefix, gotSecret, ok)
+	}
+	for _, token := range []string{"", "gk_", "gk_abc", "gk__secret", "eyJhbGciOi.x.y"} {
+		if _, _, ok := parseAPIKey(token); ok {
+			t.Fatalf("expected %q to be rejected", token)
+		}
+	}
+}
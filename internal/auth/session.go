@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	db "go-crud/internal/db/sqlc"
+)
+
+// sessionTokenPrefix starts every session token, telling them apart from
+// API keys and JWTs.
+const sessionTokenPrefix = "gs_"
+
+// SessionRole is the role of principals signed in with a password. Sessions
+// carry the users:write scope; the user service confines this role to the
+// user's own record unless an authorization policy says otherwise.
+const SessionRole = "user"
+
+// Session is a signed-in user's bearer token, shown only when it is issued.
+type Session struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"tokenType"`
+	UserID    uuid.UUID `json:"userId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// SessionStore issues and revokes session tokens for users who signed in
+// with a password, and authenticates requests carrying them.
+type SessionStore interface {
+	Authenticator
+	Create(ctx context.Context, userID uuid.UUID) (Session, error)
+	// Revoke ends the session of token. Unknown tokens are ignored.
+	Revoke(ctx context.Context, token string) error
+	// PurgeExpired removes expired sessions and reports how many were
+	// removed.
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+// PostgresSessionStore keeps only a SHA-256 hash of each token. Sessions
+// expire ttl after sign-in and stop working as soon as the user is deleted
+// or deactivated.
+type PostgresSessionStore struct {
+	q   *db.Queries
+	ttl time.Duration
+}
+
+func NewPostgresSessionStore(conn *sql.DB, ttl time.Duration) *PostgresSessionStore {
+	return &PostgresSessionStore{q: db.New(conn), ttl: ttl}
+}
+
+func (s *PostgresSessionStore) Create(ctx context.Context, userID uuid.UUID) (Session, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Session{}, fmt.Errorf("generate session token: %w", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	row, err := s.q.CreateSession(ctx, db.CreateSessionParams{
+		UserID:    userID,
+		TokenHash: hashSecret(secret),
+		ExpiresAt: time.Now().Add(s.ttl),
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	return Session{Token: sessionTokenPrefix + secret, TokenType: "Bearer", UserID: row.UserID, ExpiresAt: row.ExpiresAt}, nil
+}
+
+func (s *PostgresSessionStore) Revoke(ctx context.Context, token string) error {
+	secret, ok := strings.CutPrefix(token, sessionTokenPrefix)
+	if !ok {
+		return ErrUnsupportedToken
+	}
+	_, err := s.q.DeleteSession(ctx, hashSecret(secret))
+	return err
+}
+
+func (s *PostgresSessionStore) PurgeExpired(ctx context.Context) (int64, error) {
+	return s.q.DeleteExpiredSessions(ctx)
+}
+
+// Authenticate accepts tokens of the form gs_<secret>.
+func (s *PostgresSessionStore) Authenticate(ctx context.Context, token string) (Principal, error) {
+	secret, ok := strings.CutPrefix(token, sessionTokenPrefix)
+	if !ok || secret == "" {
+		return Principal{}, ErrUnsupportedToken
+	}
+	row, err := s.q.GetActiveSession(ctx, hashSecret(secret))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Principal{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	return SessionPrincipal(row.UserID, row.Email), nil
+}
+
+// SessionPrincipal is the principal of a user signed in with a password.
+func SessionPrincipal(userID uuid.UUID, email string) Principal {
+	return Principal{
+		Subject: "user:" + userID.String(),
+		Name:    email,
+		Scopes:  []string{ScopeUsersWrite},
+		Roles:   []string{SessionRole},
+		UserID:  userID.String(),
+	}
+}
@@ -0,0 +1,184 @@
+// Package authz decides what authenticated principals may do to users,
+// following a policy declared in a JSON file.
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"go-crud/internal/auth"
+	"go-crud/internal/user"
+)
+
+// DefaultRule names the implicit rule that denies operations no rule
+// matches.
+const DefaultRule = "default-deny"
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Rule allows or denies the operations it matches. A rule matches when every
+// condition it sets holds; within a condition, any listed value will do. "*"
+// in Actions matches every action.
+type Rule struct {
+	Name   string `json:"name"`
+	Effect string `json:"effect"`
+
+	// Actions lists the operations the rule applies to.
+	Actions []string `json:"actions"`
+	// Roles, Scopes and Subjects select principals by role, by scope
+	// (including scopes implied by those granted) and by subject. A
+	// subject ending in "*" matches by prefix, such as "apikey:*".
+	Roles    []string `json:"roles,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	Subjects []string `json:"subjects,omitempty"`
+	// Self, when set, requires the target user to be (true) or not to be
+	// (false) the principal's own record.
+	Self *bool `json:"self,omitempty"`
+	// Fields matches creates and updates setting any of these fields,
+	// named as in JSON.
+	Fields []string `json:"fields,omitempty"`
+	// Statuses matches creates and updates setting one of these statuses.
+	Statuses []string `json:"statuses,omitempty"`
+	// IncludeDeleted, when set, requires a list or export to include (true)
+	// or not to include (false) soft-deleted users.
+	IncludeDeleted *bool `json:"includeDeleted,omitempty"`
+}
+
+// Policy evaluates its rules in order: the first that matches decides, and
+// an operation no rule matches is denied by DefaultRule.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Load reads a policy from a JSON file.
+func Load(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse decodes and validates a policy, rejecting unknown fields so that a
+// misspelled condition cannot silently widen a rule.
+func Parse(r io.Reader) (*Policy, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	if len(p.Rules) == 0 {
+		return errors.New("policy has no rules")
+	}
+	seen := make(map[string]bool, len(p.Rules))
+	for i, r := range p.Rules {
+		switch {
+		case r.Name == "" || r.Name == DefaultRule:
+			return fmt.Errorf("rule %d: name must be set and not %q", i, DefaultRule)
+		case seen[r.Name]:
+			return fmt.Errorf("rule %q: duplicate name", r.Name)
+		case r.Effect != EffectAllow && r.Effect != EffectDeny:
+			return fmt.Errorf("rule %q: effect must be %s or %s", r.Name, EffectAllow, EffectDeny)
+		case len(r.Actions) == 0:
+			return fmt.Errorf("rule %q: at least one action is required", r.Name)
+		}
+		seen[r.Name] = true
+		for _, a := range r.Actions {
+			if a != "*" && !slices.Contains(user.Actions, a) {
+				return fmt.Errorf("rule %q: unknown action %q", r.Name, a)
+			}
+		}
+		for _, s := range r.Scopes {
+			if !slices.Contains(auth.AllScopes, s) {
+				return fmt.Errorf("rule %q: unknown scope %q", r.Name, s)
+			}
+		}
+		for _, s := range r.Statuses {
+			if s != user.StatusActive && s != user.StatusInactive {
+				return fmt.Errorf("rule %q: unknown status %q", r.Name, s)
+			}
+		}
+	}
+	return nil
+}
+
+// Authorize implements user.Authorizer.
+func (p *Policy) Authorize(_ context.Context, principal auth.Principal, op user.Operation) error {
+	for _, r := range p.Rules {
+		if !r.matches(principal, op) {
+			continue
+		}
+		if r.Effect == EffectAllow {
+			return nil
+		}
+		return &user.ForbiddenError{Action: op.Action, Rule: r.Name}
+	}
+	return &user.ForbiddenError{Action: op.Action, Rule: DefaultRule}
+}
+
+func (r Rule) matches(p auth.Principal, op user.Operation) bool {
+	if !slices.Contains(r.Actions, "*") && !slices.Contains(r.Actions, op.Action) {
+		return false
+	}
+	if len(r.Roles) > 0 && !slices.ContainsFunc(r.Roles, func(role string) bool { return slices.Contains(p.Roles, role) }) {
+		return false
+	}
+	if len(r.Scopes) > 0 && !slices.ContainsFunc(r.Scopes, p.HasScope) {
+		return false
+	}
+	if len(r.Subjects) > 0 && !slices.ContainsFunc(r.Subjects, func(s string) bool { return subjectMatches(s, p.Subject) }) {
+		return false
+	}
+	if r.Self != nil && isSelf(p, op) != *r.Self {
+		return false
+	}
+	if len(r.Fields) > 0 && !slices.ContainsFunc(r.Fields, func(f string) bool { return slices.Contains(op.Fields, f) }) {
+		return false
+	}
+	if len(r.Statuses) > 0 && !slices.Contains(r.Statuses, op.Status) {
+		return false
+	}
+	if r.IncludeDeleted != nil && op.IncludeDeleted != *r.IncludeDeleted {
+		return false
+	}
+	return true
+}
+
+func subjectMatches(pattern, subject string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(subject, prefix)
+	}
+	return pattern == subject
+}
+
+// isSelf reports whether op targets the principal's own user record.
+func isSelf(p auth.Principal, op user.Operation) bool {
+	return op.UserID != nil && p.UserID != "" && strings.EqualFold(op.UserID.String(), p.UserID)
+}
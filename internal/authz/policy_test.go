@@ -0,0 +1,116 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"go-crud/internal/auth"
+	"go-crud/internal/user"
+)
+
+func TestExamplePolicy(t *testing.T) {
+	policy, err := Load("../../authz-policy.example.json")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	own, other := uuid.New(), uuid.New()
+	admin := auth.Principal{Subject: "jwt:root", Roles: []string{"admin"}, Scopes: []string{auth.ScopeUsersAdmin}}
+	support := auth.Principal{Subject: "jwt:help", Roles: []string{"support"}, Scopes: []string{auth.ScopeUsersRead}}
+	member := auth.Principal{Subject: "jwt:ada", Roles: []string{"user"}, Scopes: []string{auth.ScopeUsersWrite}, UserID: own.String()}
+	session := auth.SessionPrincipal(own, "ada@example.com")
+	writeKey := auth.Principal{Subject: "apikey:1", Scopes: []string{auth.ScopeUsersWrite}}
+	stranger := auth.Principal{Subject: "jwt:nobody"}
+
+	read := func(id uuid.UUID) user.Operation { return user.Operation{Action: user.ActionRead, UserID: &id} }
+	update := func(id uuid.UUID, fields ...string) user.Operation {
+		return user.Operation{Action: user.ActionUpdate, UserID: &id, Fields: fields}
+	}
+	setStatus := func(id uuid.UUID, status string) user.Operation {
+		return user.Operation{Action: user.ActionUpdate, UserID: &id, Fields: []string{"status"}, Status: status}
+	}
+	password := func(id uuid.UUID) user.Operation {
+		return user.Operation{Action: user.ActionSetPassword, UserID: &id, Fields: []string{"password"}}
+	}
+	deleteOp := user.Operation{Action: user.ActionDelete, UserID: &other}
+	deactivate := user.Operation{Action: user.ActionCreate, Fields: []string{"firstName", "status"}, Status: user.StatusInactive}
+
+	tests := []struct {
+		name      string
+		principal auth.Principal
+		op        user.Operation
+		deniedBy  string
+	}{
+		{"admin deletes", admin, deleteOp, ""},
+		{"admin deactivates", admin, setStatus(other, user.StatusInactive), ""},
+		{"admin reads audit", admin, user.Operation{Action: user.ActionAudit}, ""},
+		{"support reads", support, read(other), ""},
+		{"support lists", support, user.Operation{Action: user.ActionList}, ""},
+		{"support exports", support, user.Operation{Action: user.ActionExport}, ""},
+		{"support cannot list deleted", support, user.Operation{Action: user.ActionList, IncludeDeleted: true}, "only-admins-see-deleted"},
+		{"support cannot export deleted", support, user.Operation{Action: user.ActionExport, IncludeDeleted: true}, "only-admins-see-deleted"},
+		{"admin lists deleted", admin, user.Operation{Action: user.ActionList, IncludeDeleted: true}, ""},
+		{"support cannot delete", support, deleteOp, "support-cannot-delete"},
+		{"support cannot update", support, update(other, "email"), DefaultRule},
+		{"support cannot deactivate", support, setStatus(other, user.StatusInactive), "only-admins-deactivate"},
+		{"user reads own record", member, read(own), ""},
+		{"user patches own record", member, update(own, "email", "phone"), ""},
+		{"user cannot read others", member, read(other), DefaultRule},
+		{"user cannot patch others", member, update(other, "email"), DefaultRule},
+		{"user cannot activate self", member, setStatus(own, user.StatusActive), "users-keep-own-status"},
+		{"user cannot deactivate self", member, setStatus(own, user.StatusInactive), "only-admins-deactivate"},
+		{"user cannot delete self", member, user.Operation{Action: user.ActionDelete, UserID: &own}, DefaultRule},
+		{"user sets own password", member, password(own), ""},
+		{"user cannot set others' password", member, password(other), DefaultRule},
+		{"session user sets own password", session, password(own), ""},
+		{"session user cannot read others", session, read(other), DefaultRule},
+		{"support cannot set passwords", support, password(other), DefaultRule},
+		{"admin resets password", admin, password(other), ""},
+		{"user cannot list", member, user.Operation{Action: user.ActionList}, DefaultRule},
+		{"api key creates", writeKey, user.Operation{Action: user.ActionCreate, Fields: []string{"firstName"}}, ""},
+		{"api key deletes", writeKey, deleteOp, ""},
+		{"api key cannot deactivate", writeKey, deactivate, "only-admins-deactivate"},
+		{"unknown principal", stranger, read(other), DefaultRule},
+	}
+	for _, tt := range tests {
+		err := policy.Authorize(context.Background(), tt.principal, tt.op)
+		if tt.deniedBy == "" {
+			if err != nil {
+				t.Fatalf("%s: expected allow, got %v", tt.name, err)
+			}
+			continue
+		}
+		var forbidden *user.ForbiddenError
+		if !errors.As(err, &forbidden) || forbidden.Rule != tt.deniedBy || forbidden.Action != tt.op.Action {
+			t.Fatalf("%s: expected denial by %q, got %v", tt.name, tt.deniedBy, err)
+		}
+		if !errors.Is(err, user.ErrForbidden) {
+			t.Fatalf("%s: expected error to match ErrForbidden", tt.name)
+		}
+	}
+}
+
+func TestParseRejectsInvalidPolicies(t *testing.T) {
+	tests := map[string]string{
+		"no rules":        `{"rules": []}`,
+		"unknown field":   `{"rules": [{"name": "a", "effect": "allow", "actions": ["*"], "role": ["admin"]}]}`,
+		"missing name":    `{"rules": [{"effect": "allow", "actions": ["*"]}]}`,
+		"reserved name":   `{"rules": [{"name": "default-deny", "effect": "deny", "actions": ["*"]}]}`,
+		"duplicate name":  `{"rules": [{"name": "a", "effect": "allow", "actions": ["*"]}, {"name": "a", "effect": "deny", "actions": ["*"]}]}`,
+		"bad effect":      `{"rules": [{"name": "a", "effect": "permit", "actions": ["*"]}]}`,
+		"no actions":      `{"rules": [{"name": "a", "effect": "allow"}]}`,
+		"unknown action":  `{"rules": [{"name": "a", "effect": "allow", "actions": ["users.purge"]}]}`,
+		"unknown scope":   `{"rules": [{"name": "a", "effect": "allow", "actions": ["*"], "scopes": ["users:all"]}]}`,
+		"unknown status":  `{"rules": [{"name": "a", "effect": "deny", "actions": ["*"], "statuses": ["inactive"]}]}`,
+		"not json object": `[]`,
+	}
+	for name, doc := range tests {
+		if _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+// Package config loads the service configuration from environment variables.
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Port     string
+	HTTP     HTTP
+	Database Database
+	Tracing  Tracing
+	Logging  Logging
+	JWT      JWT
+	Password Password
+	Mail     Mail
+
+	// SessionTTL is how long a session token issued at login stays valid.
+	SessionTTL time.Duration
+
+	// AuthzPolicyFile is the JSON authorization policy consulted for
+	// authenticated requests. Without one, scopes alone decide.
+	AuthzPolicyFile string
+
+	RequireIfMatch      bool
+	SoftDeleteRetention time.Duration
+	PurgeInterval       time.Duration
+	IdempotencyKeyTTL   time.Duration
+}
+
+// HTTP configures the http.Server. On shutdown the server reports not ready
+// for ShutdownDelay, so that load balancers stop sending traffic, then gives
+// in-flight requests up to ShutdownTimeout to finish.
+type HTTP struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	ShutdownDelay     time.Duration
+	ShutdownTimeout   time.Duration
+}
+
+// Tracing selects where spans are exported: "none", "otlp" (configured by the
+// standard OTEL_EXPORTER_OTLP_* variables) or "stdout", which writes to File
+// when set.
+type Tracing struct {
+	Exporter    string
+	File        string
+	ServiceName string
+}
+
+// Logging configures the JSON logger. RedactPII replaces email and phone
+// attributes with a placeholder.
+type Logging struct {
+	Level     slog.Level
+	RedactPII bool
+}
+
+// JWT configures bearer JWT validation, enabled when JWKS is set to a file
+// path or URL. Keys are refreshed every RefreshInterval. Roles are read from
+// RolesClaim and granted scopes through RoleScopes; UserIDClaim holds the ID
+// of the caller's own user record.
+type JWT struct {
+	JWKS            string
+	Issuer          string
+	Audience        string
+	RolesClaim      string
+	UserIDClaim     string
+	RoleScopes      map[string]string
+	RefreshInterval time.Duration
+	ClockSkew       time.Duration
+}
+
+// Password configures argon2id password hashing and the minimum length of
+// new passwords. Memory is in KiB. Changing the cost parameters upgrades
+// stored hashes as their users sign in.
+type Password struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	MinLength   int
+}
+
+// Mail configures how verification emails are sent: "file" drops them into
+// Dir as .eml files, "smtp" sends them through the relay at SMTPAddr. Each
+// links to VerificationURL with the token in its query string and expires
+// after VerificationTTL.
+type Mail struct {
+	Transport       string
+	From            string
+	Dir             string
+	SMTPAddr        string
+	SMTPUsername    string
+	SMTPPassword    string
+	VerificationURL string
+	VerificationTTL time.Duration
+}
+
+type Database struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+}
+
+// DSN returns the connection string for the pgx driver.
+func (d Database) DSN() string {
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		d.Host, d.Port, d.User, d.Password, d.Name, d.SSLMode,
+	)
+}
+
+// Load reads the configuration from the environment, falling back to
+// defaults suitable for local development.
+func Load() (Config, error) {
+	l := loader{}
+	cfg := Config{
+		Port: l.string("APP_PORT", "8080"),
+		HTTP: HTTP{
+			ReadHeaderTimeout: l.duration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+			ReadTimeout:       l.duration("HTTP_READ_TIMEOUT", 30*time.Second),
+			WriteTimeout:      l.duration("HTTP_WRITE_TIMEOUT", 60*time.Second),
+			IdleTimeout:       l.duration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+			MaxHeaderBytes:    l.int("HTTP_MAX_HEADER_BYTES", 1<<20),
+			ShutdownDelay:     l.nonNegativeDuration("SHUTDOWN_DELAY", 5*time.Second),
+			ShutdownTimeout:   l.duration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		},
+		Database: Database{
+			Host:     l.string("DB_HOST", "localhost"),
+			Port:     l.string("DB_PORT", "5432"),
+			User:     l.string("DB_USER", "postgres"),
+			Password: l.string("DB_PASSWORD", "postgres"),
+			Name:     l.string("DB_NAME", "usersdb"),
+			SSLMode:  l.string("DB_SSLMODE", "disable"),
+		},
+		Tracing: Tracing{
+			Exporter:    l.oneOf("OTEL_TRACES_EXPORTER", "none", "otlp", "stdout"),
+			File:        l.string("OTEL_TRACES_FILE", ""),
+			ServiceName: l.string("OTEL_SERVICE_NAME", "go-crud"),
+		},
+		Logging: Logging{
+			Level:     l.level("LOG_LEVEL", slog.LevelInfo),
+			RedactPII: l.bool("LOG_REDACT_PII", true),
+		},
+		JWT: JWT{
+			JWKS:            l.string("JWT_JWKS", ""),
+			Issuer:          l.string("JWT_ISSUER", ""),
+			Audience:        l.string("JWT_AUDIENCE", ""),
+			RolesClaim:      l.string("JWT_ROLES_CLAIM", "roles"),
+			UserIDClaim:     l.string("JWT_USER_ID_CLAIM", "sub"),
+			RoleScopes:      l.mapping("JWT_ROLE_SCOPES", "admin=users:admin,support=users:read,user=users:write"),
+			RefreshInterval: l.duration("JWT_JWKS_REFRESH_INTERVAL", 15*time.Minute),
+			ClockSkew:       l.nonNegativeDuration("JWT_CLOCK_SKEW", 30*time.Second),
+		},
+		Password: Password{
+			Memory:      uint32(l.int("PASSWORD_ARGON2_MEMORY_KIB", 19*1024)),
+			Iterations:  uint32(l.int("PASSWORD_ARGON2_ITERATIONS", 2)),
+			Parallelism: uint8(l.int("PASSWORD_ARGON2_PARALLELISM", 1)),
+			MinLength:   l.int("PASSWORD_MIN_LENGTH", 12),
+		},
+		Mail: Mail{
+			Transport:       l.oneOf("MAIL_TRANSPORT", "file", "smtp"),
+			From:            l.string("MAIL_FROM", "go-crud <no-reply@localhost>"),
+			Dir:             l.string("MAIL_DIR", "mail"),
+			SMTPAddr:        l.string("SMTP_ADDR", "localhost:587"),
+			SMTPUsername:    l.string("SMTP_USERNAME", ""),
+			SMTPPassword:    l.string("SMTP_PASSWORD", ""),
+			VerificationURL: l.url("EMAIL_VERIFICATION_URL", "http://localhost:8080/verify-email"),
+			VerificationTTL: l.duration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		},
+		SessionTTL:          l.duration("SESSION_TTL", 12*time.Hour),
+		AuthzPolicyFile:     l.string("AUTHZ_POLICY_FILE", ""),
+		RequireIfMatch:      l.bool("REQUIRE_IF_MATCH", false),
+		SoftDeleteRetention: l.duration("SOFT_DELETE_RETENTION", 30*24*time.Hour),
+		PurgeInterval:       l.duration("PURGE_INTERVAL", time.Hour),
+		IdempotencyKeyTTL:   l.duration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+	}
+	if cfg.JWT.JWKS != "" && (cfg.JWT.Issuer == "" || cfg.JWT.Audience == "") {
+		l.fail(fmt.Errorf("JWT_ISSUER and JWT_AUDIENCE are required with JWT_JWKS"))
+	}
+	if n := l.int("PASSWORD_ARGON2_PARALLELISM", 1); n > 255 {
+		l.fail(fmt.Errorf("invalid PASSWORD_ARGON2_PARALLELISM %d: must be at most 255", n))
+	}
+	return cfg, l.err
+}
+
+// loader reads environment variables, keeping the first parse error.
+type loader struct {
+	err error
+}
+
+func (l *loader) string(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// oneOf reads a value that must be one of allowed; the first is the default.
+func (l *loader) oneOf(key string, allowed ...string) string {
+	v := l.string(key, allowed[0])
+	if !slices.Contains(allowed, v) {
+		l.fail(fmt.Errorf("invalid %s %q: must be one of %s", key, v, strings.Join(allowed, ", ")))
+		return allowed[0]
+	}
+	return v
+}
+
+func (l *loader) bool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		l.fail(fmt.Errorf("invalid %s %q: must be true or false", key, v))
+		return fallback
+	}
+	return b
+}
+
+func (l *loader) int(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		l.fail(fmt.Errorf("invalid %s %q: must be a positive integer", key, v))
+		return fallback
+	}
+	return n
+}
+
+// mapping reads comma-separated key=value pairs.
+func (l *loader) mapping(key, fallback string) map[string]string {
+	v := l.string(key, fallback)
+	m := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || k == "" || val == "" {
+			l.fail(fmt.Errorf("invalid %s %q: must be comma-separated key=value pairs", key, v))
+			return nil
+		}
+		m[k] = val
+	}
+	return m
+}
+
+// url reads an absolute http or https URL.
+func (l *loader) url(key, fallback string) string {
+	v := l.string(key, fallback)
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		l.fail(fmt.Errorf("invalid %s %q: must be an http or https URL", key, v))
+		return fallback
+	}
+	return v
+}
+
+func (l *loader) level(key string, fallback slog.Level) slog.Level {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(v)); err != nil {
+		l.fail(fmt.Errorf("invalid %s %q: must be debug, info, warn or error", key, v))
+		return fallback
+	}
+	return level
+}
+
+// duration reads a positive duration, for TTLs and intervals.
+func (l *loader) duration(key string, fallback time.Duration) time.Duration {
+	return l.parseDuration(key, fallback, false)
+}
+
+// nonNegativeDuration reads a duration for which zero means none, such as
+// a delay or a tolerance.
+func (l *loader) nonNegativeDuration(key string, fallback time.Duration) time.Duration {
+	return l.parseDuration(key, fallback, true)
+}
+
+func (l *loader) parseDuration(key string, fallback time.Duration, allowZero bool) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	switch {
+	case err != nil || d < 0:
+		l.fail(fmt.Errorf("invalid %s %q: must be a duration such as 720h", key, v))
+		return fallback
+	case d == 0 && !allowZero:
+		l.fail(fmt.Errorf("invalid %s %q: must be a positive duration such as 720h", key, v))
+		return fallback
+	}
+	return d
+}
+
+func (l *loader) fail(err error) {
+	if l.err == nil {
+		l.err = err
+	}
+}
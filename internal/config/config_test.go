@@ -0,0 +1,130 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	for _, key := range []string{"APP_PORT", "DB_HOST", "REQUIRE_IF_MATCH", "SOFT_DELETE_RETENTION"} {
+		t.Setenv(key, "")
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Port != "8080" || cfg.Database.Host != "localhost" {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+	if cfg.RequireIfMatch || cfg.SoftDeleteRetention != 30*24*time.Hour {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoadReadsEnvironment(t *testing.T) {
+	t.Setenv("DB_NAME", "other")
+	t.Setenv("REQUIRE_IF_MATCH", "true")
+	t.Setenv("PURGE_INTERVAL", "5m")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !cfg.RequireIfMatch || cfg.PurgeInterval != 5*time.Minute {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if dsn := cfg.Database.DSN(); !strings.Contains(dsn, "dbname=other") {
+		t.Fatalf("expected dbname in DSN, got %q", dsn)
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	t.Setenv("REQUIRE_IF_MATCH", "maybe")
+	t.Setenv("PURGE_INTERVAL", "-1h")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "REQUIRE_IF_MATCH") {
+		t.Fatalf("expected the first invalid value to be reported, got %v", err)
+	}
+}
+
+func TestLoadAllowsZeroDelays(t *testing.T) {
+	t.Setenv("SHUTDOWN_DELAY", "0s")
+	t.Setenv("JWT_CLOCK_SKEW", "0")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.HTTP.ShutdownDelay != 0 || cfg.JWT.ClockSkew != 0 {
+		t.Fatalf("expected zero delays, got %s and %s", cfg.HTTP.ShutdownDelay, cfg.JWT.ClockSkew)
+	}
+
+	t.Setenv("PURGE_INTERVAL", "0s")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PURGE_INTERVAL") {
+		t.Fatalf("expected a zero interval to be rejected, got %v", err)
+	}
+}
+
+func TestLoadJWT(t *testing.T) {
+	t.Setenv("JWT_JWKS", "/etc/jwks.json")
+	t.Setenv("JWT_ISSUER", "https://idp.example.com")
+	t.Setenv("JWT_AUDIENCE", "go-crud")
+	t.Setenv("JWT_ROLE_SCOPES", "ops=users:admin, viewer=users:read")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cfg.JWT.RoleScopes) != 2 || cfg.JWT.RoleScopes["viewer"] != "users:read" {
+		t.Fatalf("unexpected role scopes: %v", cfg.JWT.RoleScopes)
+	}
+
+	t.Setenv("JWT_AUDIENCE", "")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "JWT_AUDIENCE") {
+		t.Fatalf("expected missing audience to be reported, got %v", err)
+	}
+}
+
+func TestLoadPassword(t *testing.T) {
+	t.Setenv("PASSWORD_ARGON2_MEMORY_KIB", "65536")
+	t.Setenv("PASSWORD_MIN_LENGTH", "16")
+	t.Setenv("SESSION_TTL", "1h")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	want := Password{Memory: 65536, Iterations: 2, Parallelism: 1, MinLength: 16}
+	if cfg.Password != want || cfg.SessionTTL != time.Hour {
+		t.Fatalf("unexpected config: %+v, session TTL %s", cfg.Password, cfg.SessionTTL)
+	}
+
+	t.Setenv("PASSWORD_ARGON2_PARALLELISM", "300")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "PASSWORD_ARGON2_PARALLELISM") {
+		t.Fatalf("expected parallelism to be rejected, got %v", err)
+	}
+}
+
+func TestLoadMail(t *testing.T) {
+	t.Setenv("MAIL_TRANSPORT", "smtp")
+	t.Setenv("SMTP_ADDR", "smtp.example.com:587")
+	t.Setenv("EMAIL_VERIFICATION_URL", "https://app.example.com/verify")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Mail.Transport != "smtp" || cfg.Mail.SMTPAddr != "smtp.example.com:587" || cfg.Mail.VerificationTTL != 48*time.Hour {
+		t.Fatalf("unexpected config: %+v", cfg.Mail)
+	}
+
+	for _, bad := range []string{"/verify", "ftp://example.com/verify", "https://"} {
+		t.Setenv("EMAIL_VERIFICATION_URL", bad)
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), "EMAIL_VERIFICATION_URL") {
+			t.Fatalf("%q: expected EMAIL_VERIFICATION_URL to be rejected, got %v", bad, err)
+		}
+	}
+}
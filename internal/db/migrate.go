@@ -1,27 +1,318 @@
 package db
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"go-crud/migrations"
+)
+
+// migrationLockKey identifies the advisory lock held while migrating, so that
+// replicas starting together apply each migration once.
+const migrationLockKey int64 = 0x676f6372756400
+
+const createSchemaMigrationsSQL = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+)`
+
+var (
+	ErrMigrationModified = errors.New("applied migration has been modified")
+	ErrNoDownMigration   = errors.New("migration has no down file")
 )
 
-const createUsersTableSQL = `
-CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
-
-CREATE TABLE IF NOT EXISTS users (
-    user_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    first_name VARCHAR(50) NOT NULL CHECK (char_length(first_name) >= 2),
-    last_name VARCHAR(50) NOT NULL CHECK (char_length(last_name) >= 2),
-    email VARCHAR(255) NOT NULL UNIQUE,
-    phone VARCHAR(25),
-    age INTEGER CHECK (age > 0),
-    status VARCHAR(10) NOT NULL DEFAULT 'Active' CHECK (status IN ('Active', 'Inactive')),
-    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-);
-`
+var migrationFileRE = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one schema version. Checksum is the SHA-256 of Up.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus describes one migration known to the code, the database or
+// both. Modified reports an applied migration whose file has changed since;
+// Missing one that is applied but not present in the code.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	Modified  bool
+	Missing   bool
+}
+
+// Migrator applies the migrations found in a directory of NNN_name.up.sql and
+// NNN_name.down.sql files, recording them in schema_migrations.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator loads the migrations in fsys, sorted by version.
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
 
+// Migrate applies every pending embedded migration.
 func Migrate(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(ctx, createUsersTableSQL)
+	m, err := NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up(ctx)
 	return err
 }
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() || !migrationFileRE.MatchString(e.Name()) {
+			continue
+		}
+		parts := migrationFileRE.FindStringSubmatch(e.Name())
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		} else if m.Name != parts[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return migrations, nil
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction, and returns those it applied. It refuses to run if an applied
+// migration has been modified.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		status, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkModified(status); err != nil {
+			return err
+		}
+
+		done := make(map[int64]bool)
+		for _, s := range status {
+			done[s.Version] = s.Applied
+		}
+		for _, mig := range m.migrations {
+			if done[mig.Version] {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the n most recently applied migrations, newest first, and
+// returns those it reverted.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		status, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(status) - 1; i >= 0 && len(reverted) < n; i-- {
+			s := status[i]
+			if !s.Applied {
+				continue
+			}
+			if s.Missing {
+				return fmt.Errorf("migration %d_%s is applied but not present in this build", s.Version, s.Name)
+			}
+			mig := m.migrations[slices.IndexFunc(m.migrations, func(mig Migration) bool { return mig.Version == s.Version })]
+			if mig.Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrNoDownMigration, mig.Version, mig.Name)
+			}
+			if err := m.apply(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Latest returns the version of the newest migration known to the code, or 0
+// if there are none.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the newest applied version, or 0 if none is. Unlike Status
+// it does not take the migration lock, so it is cheap enough for health
+// checks and does not wait for a migration in progress.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	var version int64
+	err := m.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// Status reports every migration in version order.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var status []MigrationStatus
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		status, err = m.status(ctx, conn)
+		return err
+	})
+	return status, err
+}
+
+// locked runs fn on a single connection holding the migration advisory lock,
+// after making sure schema_migrations exists.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	if _, err := conn.ExecContext(ctx, createSchemaMigrationsSQL); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) ([]MigrationStatus, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type record struct {
+		name, checksum string
+		appliedAt      time.Time
+	}
+	applied := make(map[int64]record)
+	for rows.Next() {
+		var version int64
+		var r record
+		if err := rows.Scan(&version, &r.name, &r.checksum, &r.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if r, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = &r.appliedAt
+			s.Modified = r.checksum != mig.Checksum
+			delete(applied, mig.Version)
+		}
+		status = append(status, s)
+	}
+	for version, r := range applied {
+		status = append(status, MigrationStatus{Version: version, Name: r.name, Applied: true, AppliedAt: &r.appliedAt, Missing: true})
+	}
+	slices.SortFunc(status, func(a, b MigrationStatus) int { return cmp.Compare(a.Version, b.Version) })
+	return status, nil
+}
+
+// apply runs the up or down script of mig and records the result in the same
+// transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, record, args := mig.Up, "INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)", []any{mig.Version, mig.Name, mig.Checksum}
+	if !up {
+		script, record, args = mig.Down, "DELETE FROM schema_migrations WHERE version = $1", []any{mig.Version}
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func checkModified(status []MigrationStatus) error {
+	for _, s := range status {
+		if s.Modified {
+			return fmt.Errorf("%w: %d_%s", ErrMigrationModified, s.Version, s.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"go-crud/migrations"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func TestLoadMigrationsOrdersAndPairsFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"010_add_index.up.sql":      {Data: []byte("CREATE INDEX i ON t (c);")},
+		"002_create_table.up.sql":   {Data: []byte("CREATE TABLE t (c INT);")},
+		"002_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		"README.md":                 {Data: []byte("ignored")},
+	}
+
+	got, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].Version != 2 || got[1].Version != 10 {
+		t.Fatalf("expected versions [2 10], got %+v", got)
+	}
+	if got[0].Name != "create_table" || got[0].Down != "DROP TABLE t;" || got[1].Down != "" {
+		t.Fatalf("unexpected pairing: %+v", got)
+	}
+	if len(got[0].Checksum) != 64 || got[0].Checksum == got[1].Checksum {
+		t.Fatalf("expected distinct SHA-256 checksums, got %q and %q", got[0].Checksum, got[1].Checksum)
+	}
+}
+
+func TestLoadMigrationsRejectsInconsistentFiles(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"down without up": {"001_a.down.sql": {Data: []byte("SELECT 1;")}},
+		"conflicting names": {
+			"001_a.up.sql": {Data: []byte("SELECT 1;")},
+			"001_b.up.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range tests {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrationsAreReversible(t *testing.T) {
+	got, err := loadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("load embedded migrations: %v", err)
+	}
+	for i, m := range got {
+		if m.Version != int64(i+1) {
+			t.Fatalf("expected contiguous versions, got %d at position %d", m.Version, i)
+		}
+		if m.Down == "" {
+			t.Fatalf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+// TestMigratorIntegration runs the embedded migrations up and down in a
+// scratch schema so that it cannot disturb other tests sharing the database.
+func TestMigratorIntegration(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("set TEST_DATABASE_URL to run migration integration tests")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer admin.Close()
+	if err := admin.PingContext(ctx); err != nil {
+		t.Skipf("db unavailable for integration test: %v", err)
+	}
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	defer admin.ExecContext(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+
+	sep := " "
+	if strings.Contains(dsn, "://") {
+		sep = "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+	}
+	conn, err := sql.Open("pgx", dsn+sep+"search_path="+schema+",public")
+	if err != nil {
+		t.Fatalf("open scoped db: %v", err)
+	}
+	defer conn.Close()
+
+	fsys := fstest.MapFS{}
+	for _, name := range []string{"001_create_users.up.sql", "001_create_users.down.sql", "004_users_version.up.sql", "004_users_version.down.sql"} {
+		b, err := migrations.FS.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		fsys[name] = &fstest.MapFile{Data: b}
+	}
+	m, err := NewMigrator(conn, fsys)
+	if err != nil {
+		t.Fatalf("new migrator: %v", err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("expected 2 migrations applied, got %d: %v", len(applied), err)
+	}
+	if applied, err := m.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("expected second up to be a no-op, got %d: %v", len(applied), err)
+	}
+
+	reverted, err := m.Down(ctx, 1)
+	if err != nil || len(reverted) != 1 || reverted[0].Version != 4 {
+		t.Fatalf("expected migration 4 reverted, got %+v: %v", reverted, err)
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if !status[0].Applied || status[1].Applied {
+		t.Fatalf("expected only migration 1 applied, got %+v", status)
+	}
+	if version, err := m.Version(ctx); err != nil || version != 1 || m.Latest() != 4 {
+		t.Fatalf("expected version 1 of 4, got %d of %d: %v", version, m.Latest(), err)
+	}
+
+	fsys["001_create_users.up.sql"] = &fstest.MapFile{Data: []byte("-- edited\n" + string(fsys["001_create_users.up.sql"].Data))}
+	edited, err := NewMigrator(conn, fsys)
+	if err != nil {
+		t.Fatalf("new migrator: %v", err)
+	}
+	if _, err := edited.Up(ctx); !errors.Is(err, ErrMigrationModified) {
+		t.Fatalf("expected ErrMigrationModified, got %v", err)
+	}
+}
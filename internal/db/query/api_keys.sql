@@ -0,0 +1,33 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (name, prefix, secret_hash, scopes)
+VALUES ($1, $2, $3, $4)
+RETURNING key_id, name, prefix, secret_hash, scopes, created_at, rotated_at, last_used_at, revoked_at;
+
+-- name: GetAPIKeyByPrefix :one
+SELECT key_id, name, prefix, secret_hash, scopes, created_at, rotated_at, last_used_at, revoked_at
+FROM api_keys
+WHERE prefix = $1;
+
+-- name: ListAPIKeys :many
+SELECT key_id, name, prefix, secret_hash, scopes, created_at, rotated_at, last_used_at, revoked_at
+FROM api_keys
+ORDER BY created_at, key_id;
+
+-- name: RotateAPIKey :one
+UPDATE api_keys
+SET prefix = $2,
+    secret_hash = $3,
+    rotated_at = NOW()
+WHERE key_id = $1 AND revoked_at IS NULL
+RETURNING key_id, name, prefix, secret_hash, scopes, created_at, rotated_at, last_used_at, revoked_at;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE key_id = $1 AND revoked_at IS NULL;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE key_id = $1
+  AND (last_used_at IS NULL OR last_used_at < sqlc.arg(used_before)::timestamptz);
@@ -0,0 +1,24 @@
+-- name: InsertAuditRecord :one
+INSERT INTO user_audit (
+  user_id,
+  action,
+  actor,
+  request_id,
+  changes
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING audit_id, user_id, action, actor, request_id, changes, created_at;
+
+-- name: ListAuditRecords :many
+SELECT audit_id, user_id, action, actor, request_id, changes, created_at
+FROM user_audit
+WHERE (sqlc.narg(user_id)::uuid IS NULL OR user_id = sqlc.narg(user_id)::uuid)
+  AND (sqlc.narg(since)::timestamptz IS NULL OR created_at >= sqlc.narg(since)::timestamptz)
+  AND (sqlc.narg(until)::timestamptz IS NULL OR created_at < sqlc.narg(until)::timestamptz)
+  AND (
+      sqlc.narg(cursor_created_at)::timestamptz IS NULL
+      OR (created_at, audit_id) < (sqlc.narg(cursor_created_at)::timestamptz, sqlc.narg(cursor_audit_id)::bigint)
+  )
+ORDER BY created_at DESC, audit_id DESC
+LIMIT sqlc.arg(page_limit);
@@ -0,0 +1,24 @@
+-- name: CreateEmailVerification :exec
+INSERT INTO email_verifications (token_hash, user_id, email, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- name: DeleteUserEmailVerifications :execrows
+DELETE FROM email_verifications
+WHERE user_id = $1;
+
+-- name: ConsumeEmailVerification :one
+DELETE FROM email_verifications
+WHERE token_hash = $1
+RETURNING user_id, email, expires_at;
+
+-- name: MarkEmailVerified :one
+UPDATE users
+SET email_verified_at = NOW(),
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $1 AND email = $2 AND deleted_at IS NULL
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at;
+
+-- name: DeleteExpiredEmailVerifications :execrows
+DELETE FROM email_verifications
+WHERE expires_at < NOW();
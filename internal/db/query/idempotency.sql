@@ -0,0 +1,40 @@
+-- name: ReserveIdempotencyKey :execrows
+INSERT INTO idempotency_keys (
+  actor,
+  idempotency_key,
+  fingerprint,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (actor, idempotency_key) DO UPDATE
+SET fingerprint = EXCLUDED.fingerprint,
+    status_code = NULL,
+    response_headers = '{}',
+    response_body = NULL,
+    created_at = NOW(),
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= NOW();
+
+-- name: GetIdempotencyKey :one
+SELECT actor, idempotency_key, fingerprint, status_code, response_headers, response_body, created_at, expires_at
+FROM idempotency_keys
+WHERE actor = $1
+  AND idempotency_key = $2;
+
+-- name: CompleteIdempotencyKey :exec
+UPDATE idempotency_keys
+SET status_code = $3,
+    response_headers = $4,
+    response_body = $5
+WHERE actor = $1
+  AND idempotency_key = $2;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE actor = $1
+  AND idempotency_key = $2;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at <= NOW();
@@ -0,0 +1,25 @@
+-- name: CreateSession :one
+INSERT INTO sessions (user_id, token_hash, expires_at)
+VALUES ($1, $2, $3)
+RETURNING session_id, user_id, token_hash, created_at, expires_at;
+
+-- name: GetActiveSession :one
+SELECT s.session_id, s.user_id, s.expires_at, u.email
+FROM sessions s
+JOIN users u ON u.user_id = s.user_id
+WHERE s.token_hash = $1
+  AND s.expires_at > NOW()
+  AND u.deleted_at IS NULL
+  AND u.status = 'Active';
+
+-- name: DeleteSession :execrows
+DELETE FROM sessions
+WHERE token_hash = $1;
+
+-- name: DeleteUserSessions :execrows
+DELETE FROM sessions
+WHERE user_id = $1;
+
+-- name: DeleteExpiredSessions :execrows
+DELETE FROM sessions
+WHERE expires_at <= NOW();
@@ -9,17 +9,41 @@ INSERT INTO users (
 ) VALUES (
   $1, $2, $3, $4, $5, $6
 )
-RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at;
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at;
 
 -- name: GetUserByID :one
-SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at
 FROM users
-WHERE user_id = $1;
+WHERE user_id = $1 AND deleted_at IS NULL;
 
--- name: ListUsers :many
-SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
+-- name: GetUserByIDForUpdate :one
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at
 FROM users
-ORDER BY created_at DESC;
+WHERE user_id = $1 AND (sqlc.arg(include_deleted)::bool OR deleted_at IS NULL)
+FOR UPDATE;
+
+-- name: SearchUsers :many
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at,
+       first_name_score, last_name_score, email_score, text_rank
+FROM (
+    SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at,
+           word_similarity(sqlc.arg(query)::text, first_name)::real AS first_name_score,
+           word_similarity(sqlc.arg(query)::text, last_name)::real AS last_name_score,
+           word_similarity(sqlc.arg(query)::text, email)::real AS email_score,
+           ts_rank(
+               to_tsvector('simple', first_name || ' ' || last_name || ' ' || email),
+               plainto_tsquery('simple', sqlc.arg(query)::text)
+           )::real AS text_rank
+    FROM users
+    WHERE deleted_at IS NULL
+      AND (
+          to_tsvector('simple', first_name || ' ' || last_name || ' ' || email) @@ plainto_tsquery('simple', sqlc.arg(query)::text)
+          OR (first_name || ' ' || last_name) % sqlc.arg(query)::text
+          OR email ILIKE sqlc.arg(email_pattern)::text
+      )
+) matches
+ORDER BY text_rank + GREATEST(first_name_score, last_name_score, email_score) DESC, user_id
+LIMIT sqlc.arg(result_limit);
 
 -- name: UpdateUser :one
 UPDATE users
@@ -29,10 +53,50 @@ SET first_name = $2,
     phone = $5,
     age = $6,
     status = $7,
-    updated_at = NOW()
-WHERE user_id = $1
-RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at;
+    -- A new address must be verified again.
+    email_verified_at = CASE WHEN email = $4 THEN email_verified_at END,
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $1 AND deleted_at IS NULL
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at;
+
+-- name: SoftDeleteUser :exec
+UPDATE users
+SET deleted_at = NOW(),
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL,
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $1 AND deleted_at IS NOT NULL
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at;
 
--- name: DeleteUser :exec
+-- name: PurgeDeletedUsers :execrows
 DELETE FROM users
+WHERE deleted_at IS NOT NULL AND deleted_at < sqlc.arg(deleted_before)::timestamptz;
+
+-- name: CountUsersByStatus :many
+SELECT status, (deleted_at IS NOT NULL)::boolean AS deleted, COUNT(*) AS count
+FROM users
+GROUP BY status, deleted_at IS NOT NULL;
+
+-- name: GetUserByEmail :one
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at
+FROM users
+WHERE email = $1 AND deleted_at IS NULL;
+
+-- name: GetPasswordHash :one
+SELECT password_hash
+FROM user_passwords
 WHERE user_id = $1;
+
+-- name: SetPasswordHash :exec
+INSERT INTO user_passwords (user_id, password_hash)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET password_hash = EXCLUDED.password_hash,
+    updated_at = NOW();
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createAPIKey = `-- name: CreateAPIKey :one
+INSERT INTO api_keys (name, prefix, secret_hash, scopes)
+VALUES ($1, $2, $3, $4)
+RETURNING key_id, name, prefix, secret_hash, scopes, created_at, rotated_at, last_used_at, revoked_at
+`
+
+type CreateAPIKeyParams struct {
+	Name       string
+	Prefix     string
+	SecretHash []byte
+	Scopes     string
+}
+
+func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, createAPIKey,
+		arg.Name,
+		arg.Prefix,
+		arg.SecretHash,
+		arg.Scopes,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.KeyID,
+		&i.Name,
+		&i.Prefix,
+		&i.SecretHash,
+		&i.Scopes,
+		&i.CreatedAt,
+		&i.RotatedAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getAPIKeyByPrefix = `-- name: GetAPIKeyByPrefix :one
+SELECT key_id, name, prefix, secret_hash, scopes, created_at, rotated_at, last_used_at, revoked_at
+FROM api_keys
+WHERE prefix = $1
+`
+
+func (q *Queries) GetAPIKeyByPrefix(ctx context.Context, prefix string) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, getAPIKeyByPrefix, prefix)
+	var i ApiKey
+	err := row.Scan(
+		&i.KeyID,
+		&i.Name,
+		&i.Prefix,
+		&i.SecretHash,
+		&i.Scopes,
+		&i.CreatedAt,
+		&i.RotatedAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const listAPIKeys = `-- name: ListAPIKeys :many
+SELECT key_id, name, prefix, secret_hash, scopes, created_at, rotated_at, last_used_at, revoked_at
+FROM api_keys
+ORDER BY created_at, key_id
+`
+
+func (q *Queries) ListAPIKeys(ctx context.Context) ([]ApiKey, error) {
+	rows, err := q.db.QueryContext(ctx, listAPIKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ApiKey
+	for rows.Next() {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.KeyID,
+			&i.Name,
+			&i.Prefix,
+			&i.SecretHash,
+			&i.Scopes,
+			&i.CreatedAt,
+			&i.RotatedAt,
+			&i.LastUsedAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAPIKey = `-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE key_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAPIKey(ctx context.Context, keyID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeAPIKey, keyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateAPIKey = `-- name: RotateAPIKey :one
+UPDATE api_keys
+SET prefix = $2,
+    secret_hash = $3,
+    rotated_at = NOW()
+WHERE key_id = $1 AND revoked_at IS NULL
+RETURNING key_id, name, prefix, secret_hash, scopes, created_at, rotated_at, last_used_at, revoked_at
+`
+
+type RotateAPIKeyParams struct {
+	KeyID      uuid.UUID
+	Prefix     string
+	SecretHash []byte
+}
+
+func (q *Queries) RotateAPIKey(ctx context.Context, arg RotateAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRowContext(ctx, rotateAPIKey, arg.KeyID, arg.Prefix, arg.SecretHash)
+	var i ApiKey
+	err := row.Scan(
+		&i.KeyID,
+		&i.Name,
+		&i.Prefix,
+		&i.SecretHash,
+		&i.Scopes,
+		&i.CreatedAt,
+		&i.RotatedAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const touchAPIKey = `-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE key_id = $1
+  AND (last_used_at IS NULL OR last_used_at < $2::timestamptz)
+`
+
+type TouchAPIKeyParams struct {
+	KeyID      uuid.UUID
+	UsedBefore time.Time
+}
+
+func (q *Queries) TouchAPIKey(ctx context.Context, arg TouchAPIKeyParams) error {
+	_, err := q.db.ExecContext(ctx, touchAPIKey, arg.KeyID, arg.UsedBefore)
+	return err
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+const insertAuditRecord = `-- name: InsertAuditRecord :one
+INSERT INTO user_audit (
+  user_id,
+  action,
+  actor,
+  request_id,
+  changes
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING audit_id, user_id, action, actor, request_id, changes, created_at
+`
+
+type InsertAuditRecordParams struct {
+	UserID    uuid.UUID
+	Action    string
+	Actor     string
+	RequestID sql.NullString
+	Changes   json.RawMessage
+}
+
+func (q *Queries) InsertAuditRecord(ctx context.Context, arg InsertAuditRecordParams) (UserAudit, error) {
+	row := q.db.QueryRowContext(ctx, insertAuditRecord,
+		arg.UserID,
+		arg.Action,
+		arg.Actor,
+		arg.RequestID,
+		arg.Changes,
+	)
+	var i UserAudit
+	err := row.Scan(
+		&i.AuditID,
+		&i.UserID,
+		&i.Action,
+		&i.Actor,
+		&i.RequestID,
+		&i.Changes,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listAuditRecords = `-- name: ListAuditRecords :many
+SELECT audit_id, user_id, action, actor, request_id, changes, created_at
+FROM user_audit
+WHERE ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::timestamptz IS NULL OR created_at >= $2::timestamptz)
+  AND ($3::timestamptz IS NULL OR created_at < $3::timestamptz)
+  AND (
+      $4::timestamptz IS NULL
+      OR (created_at, audit_id) < ($4::timestamptz, $5::bigint)
+  )
+ORDER BY created_at DESC, audit_id DESC
+LIMIT $6
+`
+
+type ListAuditRecordsParams struct {
+	UserID          uuid.NullUUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	CursorCreatedAt sql.NullTime
+	CursorAuditID   sql.NullInt64
+	PageLimit       int32
+}
+
+func (q *Queries) ListAuditRecords(ctx context.Context, arg ListAuditRecordsParams) ([]UserAudit, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditRecords,
+		arg.UserID,
+		arg.Since,
+		arg.Until,
+		arg.CursorCreatedAt,
+		arg.CursorAuditID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserAudit
+	for rows.Next() {
+		var i UserAudit
+		if err := rows.Scan(
+			&i.AuditID,
+			&i.UserID,
+			&i.Action,
+			&i.Actor,
+			&i.RequestID,
+			&i.Changes,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
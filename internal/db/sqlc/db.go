@@ -19,3 +19,9 @@ type Queries struct {
 func New(db DBTX) *Queries {
 	return &Queries{db: db}
 }
+
+func (q *Queries) WithTx(tx *sql.Tx) *Queries {
+	return &Queries{
+		db: tx,
+	}
+}
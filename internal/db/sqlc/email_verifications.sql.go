@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const consumeEmailVerification = `-- name: ConsumeEmailVerification :one
+DELETE FROM email_verifications
+WHERE token_hash = $1
+RETURNING user_id, email, expires_at
+`
+
+type ConsumeEmailVerificationRow struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) ConsumeEmailVerification(ctx context.Context, tokenHash []byte) (ConsumeEmailVerificationRow, error) {
+	row := q.db.QueryRowContext(ctx, consumeEmailVerification, tokenHash)
+	var i ConsumeEmailVerificationRow
+	err := row.Scan(&i.UserID, &i.Email, &i.ExpiresAt)
+	return i, err
+}
+
+const createEmailVerification = `-- name: CreateEmailVerification :exec
+INSERT INTO email_verifications (token_hash, user_id, email, expires_at)
+VALUES ($1, $2, $3, $4)
+`
+
+type CreateEmailVerificationParams struct {
+	TokenHash []byte
+	UserID    uuid.UUID
+	Email     string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateEmailVerification(ctx context.Context, arg CreateEmailVerificationParams) error {
+	_, err := q.db.ExecContext(ctx, createEmailVerification,
+		arg.TokenHash,
+		arg.UserID,
+		arg.Email,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const deleteExpiredEmailVerifications = `-- name: DeleteExpiredEmailVerifications :execrows
+DELETE FROM email_verifications
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredEmailVerifications(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredEmailVerifications)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteUserEmailVerifications = `-- name: DeleteUserEmailVerifications :execrows
+DELETE FROM email_verifications
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserEmailVerifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserEmailVerifications, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :one
+UPDATE users
+SET email_verified_at = NOW(),
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $1 AND email = $2 AND deleted_at IS NULL
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at
+`
+
+type MarkEmailVerifiedParams struct {
+	UserID uuid.UUID
+	Email  string
+}
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, markEmailVerified, arg.UserID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Phone,
+		&i.Age,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const completeIdempotencyKey = `-- name: CompleteIdempotencyKey :exec
+UPDATE idempotency_keys
+SET status_code = $3,
+    response_headers = $4,
+    response_body = $5
+WHERE actor = $1
+  AND idempotency_key = $2
+`
+
+type CompleteIdempotencyKeyParams struct {
+	Actor           string
+	IdempotencyKey  string
+	StatusCode      sql.NullInt32
+	ResponseHeaders json.RawMessage
+	ResponseBody    []byte
+}
+
+func (q *Queries) CompleteIdempotencyKey(ctx context.Context, arg CompleteIdempotencyKeyParams) error {
+	_, err := q.db.ExecContext(ctx, completeIdempotencyKey,
+		arg.Actor,
+		arg.IdempotencyKey,
+		arg.StatusCode,
+		arg.ResponseHeaders,
+		arg.ResponseBody,
+	)
+	return err
+}
+
+const deleteExpiredIdempotencyKeys = `-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at <= NOW()
+`
+
+func (q *Queries) DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredIdempotencyKeys)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteIdempotencyKey = `-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE actor = $1
+  AND idempotency_key = $2
+`
+
+type DeleteIdempotencyKeyParams struct {
+	Actor          string
+	IdempotencyKey string
+}
+
+func (q *Queries) DeleteIdempotencyKey(ctx context.Context, arg DeleteIdempotencyKeyParams) error {
+	_, err := q.db.ExecContext(ctx, deleteIdempotencyKey, arg.Actor, arg.IdempotencyKey)
+	return err
+}
+
+const getIdempotencyKey = `-- name: GetIdempotencyKey :one
+SELECT actor, idempotency_key, fingerprint, status_code, response_headers, response_body, created_at, expires_at
+FROM idempotency_keys
+WHERE actor = $1
+  AND idempotency_key = $2
+`
+
+type GetIdempotencyKeyParams struct {
+	Actor          string
+	IdempotencyKey string
+}
+
+func (q *Queries) GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (IdempotencyKey, error) {
+	row := q.db.QueryRowContext(ctx, getIdempotencyKey, arg.Actor, arg.IdempotencyKey)
+	var i IdempotencyKey
+	err := row.Scan(
+		&i.Actor,
+		&i.IdempotencyKey,
+		&i.Fingerprint,
+		&i.StatusCode,
+		&i.ResponseHeaders,
+		&i.ResponseBody,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const reserveIdempotencyKey = `-- name: ReserveIdempotencyKey :execrows
+INSERT INTO idempotency_keys (
+  actor,
+  idempotency_key,
+  fingerprint,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (actor, idempotency_key) DO UPDATE
+SET fingerprint = EXCLUDED.fingerprint,
+    status_code = NULL,
+    response_headers = '{}',
+    response_body = NULL,
+    created_at = NOW(),
+    expires_at = EXCLUDED.expires_at
+WHERE idempotency_keys.expires_at <= NOW()
+`
+
+type ReserveIdempotencyKeyParams struct {
+	Actor          string
+	IdempotencyKey string
+	Fingerprint    string
+	ExpiresAt      time.Time
+}
+
+func (q *Queries) ReserveIdempotencyKey(ctx context.Context, arg ReserveIdempotencyKeyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, reserveIdempotencyKey,
+		arg.Actor,
+		arg.IdempotencyKey,
+		arg.Fingerprint,
+		arg.ExpiresAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -2,19 +2,78 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	KeyID      uuid.UUID    `json:"key_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	SecretHash []byte       `json:"secret_hash"`
+	Scopes     string       `json:"scopes"`
+	CreatedAt  time.Time    `json:"created_at"`
+	RotatedAt  sql.NullTime `json:"rotated_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+}
+
+type EmailVerification struct {
+	TokenHash []byte    `json:"token_hash"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type IdempotencyKey struct {
+	Actor           string          `json:"actor"`
+	IdempotencyKey  string          `json:"idempotency_key"`
+	Fingerprint     string          `json:"fingerprint"`
+	StatusCode      sql.NullInt32   `json:"status_code"`
+	ResponseHeaders json.RawMessage `json:"response_headers"`
+	ResponseBody    []byte          `json:"response_body"`
+	CreatedAt       time.Time       `json:"created_at"`
+	ExpiresAt       time.Time       `json:"expires_at"`
+}
+
+type Session struct {
+	SessionID uuid.UUID `json:"session_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	TokenHash []byte    `json:"token_hash"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type User struct {
-	UserID    uuid.UUID      `json:"user_id"`
-	FirstName string         `json:"first_name"`
-	LastName  string         `json:"last_name"`
-	Email     string         `json:"email"`
-	Phone     sql.NullString `json:"phone"`
-	Age       sql.NullInt32  `json:"age"`
-	Status    string         `json:"status"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
+	UserID          uuid.UUID      `json:"user_id"`
+	FirstName       string         `json:"first_name"`
+	LastName        string         `json:"last_name"`
+	Email           string         `json:"email"`
+	Phone           sql.NullString `json:"phone"`
+	Age             sql.NullInt32  `json:"age"`
+	Status          string         `json:"status"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	Version         int64          `json:"version"`
+	DeletedAt       sql.NullTime   `json:"deleted_at"`
+	EmailVerifiedAt sql.NullTime   `json:"email_verified_at"`
+}
+
+type UserAudit struct {
+	AuditID   int64           `json:"audit_id"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	RequestID sql.NullString  `json:"request_id"`
+	Changes   json.RawMessage `json:"changes"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type UserPassword struct {
+	UserID       uuid.UUID `json:"user_id"`
+	PasswordHash string    `json:"password_hash"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
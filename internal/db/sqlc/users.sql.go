@@ -3,10 +3,46 @@ package db
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countUsersByStatus = `-- name: CountUsersByStatus :many
+SELECT status, (deleted_at IS NOT NULL)::boolean AS deleted, COUNT(*) AS count
+FROM users
+GROUP BY status, deleted_at IS NOT NULL
+`
+
+type CountUsersByStatusRow struct {
+	Status  string `json:"status"`
+	Deleted bool   `json:"deleted"`
+	Count   int64  `json:"count"`
+}
+
+func (q *Queries) CountUsersByStatus(ctx context.Context) ([]CountUsersByStatusRow, error) {
+	rows, err := q.db.QueryContext(ctx, countUsersByStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountUsersByStatusRow
+	for rows.Next() {
+		var i CountUsersByStatusRow
+		if err := rows.Scan(&i.Status, &i.Deleted, &i.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
   first_name,
@@ -18,7 +54,7 @@ INSERT INTO users (
 ) VALUES (
   $1, $2, $3, $4, $5, $6
 )
-RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at
 `
 
 type CreateUserParams struct {
@@ -50,24 +86,56 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
-const deleteUser = `-- name: DeleteUser :exec
-DELETE FROM users
+const getPasswordHash = `-- name: GetPasswordHash :one
+SELECT password_hash
+FROM user_passwords
 WHERE user_id = $1
 `
 
-func (q *Queries) DeleteUser(ctx context.Context, userID uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteUser, userID)
-	return err
+func (q *Queries) GetPasswordHash(ctx context.Context, userID uuid.UUID) (string, error) {
+	row := q.db.QueryRowContext(ctx, getPasswordHash, userID)
+	var password_hash string
+	err := row.Scan(&password_hash)
+	return password_hash, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at
+FROM users
+WHERE email = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Phone,
+		&i.Age,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at
 FROM users
-WHERE user_id = $1
+WHERE user_id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetUserByID(ctx context.Context, userID uuid.UUID) (User, error) {
@@ -83,25 +151,145 @@ func (q *Queries) GetUserByID(ctx context.Context, userID uuid.UUID) (User, erro
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
-const listUsers = `-- name: ListUsers :many
-SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
+const getUserByIDForUpdate = `-- name: GetUserByIDForUpdate :one
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at
 FROM users
-ORDER BY created_at DESC
+WHERE user_id = $1 AND ($2::bool OR deleted_at IS NULL)
+FOR UPDATE
+`
+
+type GetUserByIDForUpdateParams struct {
+	UserID         uuid.UUID
+	IncludeDeleted bool
+}
+
+func (q *Queries) GetUserByIDForUpdate(ctx context.Context, arg GetUserByIDForUpdateParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByIDForUpdate, arg.UserID, arg.IncludeDeleted)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Phone,
+		&i.Age,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at IS NOT NULL AND deleted_at < $1::timestamptz
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreUser = `-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL,
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $1 AND deleted_at IS NOT NULL
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at
+`
+
+func (q *Queries) RestoreUser(ctx context.Context, userID uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, restoreUser, userID)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Phone,
+		&i.Age,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at,
+       first_name_score, last_name_score, email_score, text_rank
+FROM (
+    SELECT user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at,
+           word_similarity($1::text, first_name)::real AS first_name_score,
+           word_similarity($1::text, last_name)::real AS last_name_score,
+           word_similarity($1::text, email)::real AS email_score,
+           ts_rank(
+               to_tsvector('simple', first_name || ' ' || last_name || ' ' || email),
+               plainto_tsquery('simple', $1::text)
+           )::real AS text_rank
+    FROM users
+    WHERE deleted_at IS NULL
+      AND (
+          to_tsvector('simple', first_name || ' ' || last_name || ' ' || email) @@ plainto_tsquery('simple', $1::text)
+          OR (first_name || ' ' || last_name) % $1::text
+          OR email ILIKE $2::text
+      )
+) matches
+ORDER BY text_rank + GREATEST(first_name_score, last_name_score, email_score) DESC, user_id
+LIMIT $3
 `
 
-func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
-	rows, err := q.db.QueryContext(ctx, listUsers)
+type SearchUsersParams struct {
+	Query        string
+	EmailPattern string
+	ResultLimit  int32
+}
+
+type SearchUsersRow struct {
+	UserID          uuid.UUID      `json:"user_id"`
+	FirstName       string         `json:"first_name"`
+	LastName        string         `json:"last_name"`
+	Email           string         `json:"email"`
+	Phone           sql.NullString `json:"phone"`
+	Age             sql.NullInt32  `json:"age"`
+	Status          string         `json:"status"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	Version         int64          `json:"version"`
+	DeletedAt       sql.NullTime   `json:"deleted_at"`
+	EmailVerifiedAt sql.NullTime   `json:"email_verified_at"`
+	FirstNameScore  float32        `json:"first_name_score"`
+	LastNameScore   float32        `json:"last_name_score"`
+	EmailScore      float32        `json:"email_score"`
+	TextRank        float32        `json:"text_rank"`
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, arg.Query, arg.EmailPattern, arg.ResultLimit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []User
+	var items []SearchUsersRow
 	for rows.Next() {
-		var i User
+		var i SearchUsersRow
 		if err := rows.Scan(
 			&i.UserID,
 			&i.FirstName,
@@ -112,6 +300,13 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Version,
+			&i.DeletedAt,
+			&i.EmailVerifiedAt,
+			&i.FirstNameScore,
+			&i.LastNameScore,
+			&i.EmailScore,
+			&i.TextRank,
 		); err != nil {
 			return nil, err
 		}
@@ -126,6 +321,37 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 	return items, nil
 }
 
+const setPasswordHash = `-- name: SetPasswordHash :exec
+INSERT INTO user_passwords (user_id, password_hash)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET password_hash = EXCLUDED.password_hash,
+    updated_at = NOW()
+`
+
+type SetPasswordHashParams struct {
+	UserID       uuid.UUID
+	PasswordHash string
+}
+
+func (q *Queries) SetPasswordHash(ctx context.Context, arg SetPasswordHashParams) error {
+	_, err := q.db.ExecContext(ctx, setPasswordHash, arg.UserID, arg.PasswordHash)
+	return err
+}
+
+const softDeleteUser = `-- name: SoftDeleteUser :exec
+UPDATE users
+SET deleted_at = NOW(),
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) SoftDeleteUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, softDeleteUser, userID)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET first_name = $2,
@@ -134,9 +360,12 @@ SET first_name = $2,
     phone = $5,
     age = $6,
     status = $7,
-    updated_at = NOW()
-WHERE user_id = $1
-RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at
+    -- A new address must be verified again.
+    email_verified_at = CASE WHEN email = $4 THEN email_verified_at END,
+    updated_at = NOW(),
+    version = version + 1
+WHERE user_id = $1 AND deleted_at IS NULL
+RETURNING user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at
 `
 
 type UpdateUserParams struct {
@@ -170,6 +399,9 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Version,
+		&i.DeletedAt,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"go-crud/internal/auth"
+	"go-crud/internal/problem"
+	"go-crud/internal/user"
+)
+
+const (
+	problemTypeUnauthenticated = "/problems/unauthenticated"
+	problemTypeForbidden       = "/problems/forbidden"
+)
+
+// routeScopes lists the routes needing more than the scope implied by their
+// method (see requiredScope), keyed by method and chi route pattern.
+var routeScopes = map[string]string{
+	"POST /users/{id}/restore": auth.ScopeUsersAdmin,
+	"GET /users/{id}/audit":    auth.ScopeUsersAdmin,
+	"GET /audit":               auth.ScopeUsersAdmin,
+}
+
+// authenticate resolves the bearer token in the Authorization header with the
+// first authenticator that recognises it, and attributes the request to the
+// resulting principal.
+func authenticate(authenticators []auth.Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+				unauthenticated(w, r, "missing bearer token")
+				return
+			}
+			token = strings.TrimSpace(token)
+
+			ctx := r.Context()
+			for _, a := range authenticators {
+				p, err := a.Authenticate(ctx, token)
+				switch {
+				case errors.Is(err, auth.ErrUnsupportedToken):
+					continue
+				case errors.Is(err, auth.ErrInvalidCredentials):
+					slog.DebugContext(ctx, "authentication failed", "error", err)
+					unauthenticated(w, r, "invalid credentials")
+					return
+				case err != nil:
+					slog.ErrorContext(ctx, "authenticate", "error", err)
+					problem.Write(w, r, problem.New(http.StatusInternalServerError, "internal server error"))
+					return
+				}
+				ctx = auth.WithPrincipal(ctx, p)
+				ctx = user.WithActor(ctx, p.Actor())
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			unauthenticated(w, r, "unsupported bearer token")
+		})
+	}
+}
+
+func unauthenticated(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="go-crud"`)
+	problem.Write(w, r, problem.New(http.StatusUnauthorized, detail).WithCode(problemTypeUnauthenticated, "unauthenticated"))
+}
+
+// requireScope rejects principals lacking the scope of the matched route. It
+// must run after routing, as an inline middleware.
+func requireScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := requiredScope(r)
+		p, _ := auth.PrincipalFromContext(r.Context())
+		if !p.HasScope(scope) {
+			problem.Write(w, r, problem.New(http.StatusForbidden, "this request requires the "+scope+" scope").WithCode(problemTypeForbidden, "insufficient_scope"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requiredScope is users:read for safe methods and users:write otherwise,
+// raised to users:admin for admin routes, the routes in routeScopes and
+// listings that include soft-deleted users.
+func requiredScope(r *http.Request) string {
+	pattern := chi.RouteContext(r.Context()).RoutePattern()
+	if scope, ok := routeScopes[r.Method+" "+pattern]; ok {
+		return scope
+	}
+	if strings.HasPrefix(pattern, "/admin/") {
+		return auth.ScopeUsersAdmin
+	}
+	if includeDeleted, _ := strconv.ParseBool(r.URL.Query().Get("includeDeleted")); includeDeleted {
+		return auth.ScopeUsersAdmin
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return auth.ScopeUsersRead
+	}
+	return auth.ScopeUsersWrite
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-crud/internal/auth"
+	"go-crud/internal/user"
+)
+
+// tokenAuthenticator accepts the tokens in its map.
+type tokenAuthenticator map[string]auth.Principal
+
+func (a tokenAuthenticator) Authenticate(_ context.Context, token string) (auth.Principal, error) {
+	if !strings.HasPrefix(token, "test_") {
+		return auth.Principal{}, auth.ErrUnsupportedToken
+	}
+	p, ok := a[token]
+	if !ok {
+		return auth.Principal{}, auth.ErrInvalidCredentials
+	}
+	return p, nil
+}
+
+func TestAuthRequiresTokenAndScope(t *testing.T) {
+	authn := tokenAuthenticator{
+		"test_reader": {Subject: "apikey:reader", Scopes: []string{auth.ScopeUsersRead}},
+		"test_writer": {Subject: "apikey:writer", Scopes: []string{auth.ScopeUsersWrite}},
+		"test_admin":  {Subject: "apikey:admin", Scopes: []string{auth.ScopeUsersAdmin}},
+	}
+	router := NewRouter(user.NewHandler(nil), WithAuth(authn))
+
+	// Requests that get past authorization fail validation with 400
+	// before reaching the (nil) service.
+	tests := []struct {
+		name, method, path, token string
+		want                      int
+	}{
+		{"no token", http.MethodGet, "/users/not-a-uuid", "", http.StatusUnauthorized},
+		{"unknown token", http.MethodGet, "/users/not-a-uuid", "test_nobody", http.StatusUnauthorized},
+		{"unsupported token", http.MethodGet, "/users/not-a-uuid", "opaque", http.StatusUnauthorized},
+		{"reader reads", http.MethodGet, "/users/not-a-uuid", "test_reader", http.StatusBadRequest},
+		{"reader cannot write", http.MethodPatch, "/users/not-a-uuid", "test_reader", http.StatusForbidden},
+		{"writer writes", http.MethodPatch, "/users/not-a-uuid", "test_writer", http.StatusBadRequest},
+		{"writer cannot restore", http.MethodPost, "/users/not-a-uuid/restore", "test_writer", http.StatusForbidden},
+		{"writer cannot list deleted", http.MethodGet, "/users?includeDeleted=true&limit=0", "test_writer", http.StatusForbidden},
+		{"admin restores", http.MethodPost, "/users/not-a-uuid/restore", "test_admin", http.StatusBadRequest},
+		{"health stays open", http.MethodGet, "/livez", "", http.StatusOK},
+		{"email verification stays open", http.MethodPost, "/users/verify-email", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			if res.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, res.Code, res.Body)
+			}
+			if tt.want == http.StatusUnauthorized && res.Header().Get("WWW-Authenticate") == "" {
+				t.Fatal("expected WWW-Authenticate header on 401")
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package http
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dbMigrate "go-crud/internal/db"
+)
+
+// readinessCheckTimeout bounds each readiness check, so that a hung
+// dependency fails the probe instead of stalling it.
+const readinessCheckTimeout = 2 * time.Second
+
+// Check is one dependency consulted by /readyz. Run returns details to report
+// alongside the result, and an error if the dependency is not usable.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (map[string]any, error)
+}
+
+// CheckResult is the outcome of one Check.
+type CheckResult struct {
+	Status  string         `json:"status"`
+	Error   string         `json:"error,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Health serves the liveness and readiness probes. Readiness turns false
+// when shutdown begins, before the listener closes, so that load balancers
+// move traffic elsewhere while in-flight requests drain.
+type Health struct {
+	shuttingDown atomic.Bool
+	checks       []Check
+}
+
+func NewHealth(checks ...Check) *Health {
+	return &Health{checks: checks}
+}
+
+// Shutdown marks the server as shutting down.
+func (h *Health) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// Live reports that the process is up and serving requests. It checks no
+// dependencies, so that an outage of Postgres does not get pods restarted.
+func (h *Health) Live(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// Ready runs every check concurrently and reports 503 if any fails or the
+// server is shutting down.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	results := make(map[string]CheckResult, len(h.checks)+1)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+			defer cancel()
+
+			res := CheckResult{Status: "ok"}
+			details, err := c.Run(ctx)
+			res.Details = details
+			if err != nil {
+				res.Status, res.Error = "fail", err.Error()
+			}
+			mu.Lock()
+			results[c.Name] = res
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	shutdown := CheckResult{Status: "ok"}
+	if h.shuttingDown.Load() {
+		shutdown = CheckResult{Status: "fail", Error: "server is shutting down"}
+	}
+	results["shutdown"] = shutdown
+
+	resp, status := healthResponse{Status: "ready", Checks: results}, http.StatusOK
+	for _, res := range results {
+		if res.Status != "ok" {
+			resp.Status, status = "not ready", http.StatusServiceUnavailable
+		}
+	}
+	writeHealth(w, status, resp)
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// DatabaseCheck pings db and reports its connection pool statistics.
+func DatabaseCheck(db *sql.DB) Check {
+	return Check{Name: "database", Run: func(ctx context.Context) (map[string]any, error) {
+		start := time.Now()
+		err := db.PingContext(ctx)
+		stats := db.Stats()
+		return map[string]any{
+			"latencyMs":          time.Since(start).Milliseconds(),
+			"maxOpenConnections": stats.MaxOpenConnections,
+			"openConnections":    stats.OpenConnections,
+			"inUse":              stats.InUse,
+			"idle":               stats.Idle,
+			"waitCount":          stats.WaitCount,
+			"waitDurationMs":     stats.WaitDuration.Milliseconds(),
+		}, err
+	}}
+}
+
+// MigrationCheck fails until the database schema is at least at the newest
+// migration this build knows. A newer schema, left by a newer replica during
+// a rolling deploy, is accepted.
+func MigrationCheck(m *dbMigrate.Migrator) Check {
+	return Check{Name: "migrations", Run: func(ctx context.Context) (map[string]any, error) {
+		version, err := m.Version(ctx)
+		details := map[string]any{"version": version, "expected": m.Latest()}
+		if err != nil {
+			return details, err
+		}
+		if version < m.Latest() {
+			return details, fmt.Errorf("schema is at version %d, expected %d", version, m.Latest())
+		}
+		return details, nil
+	}}
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-crud/internal/user"
+)
+
+func getHealth(t *testing.T, router http.Handler, path string) (int, healthResponse) {
+	t.Helper()
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+	var body healthResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("decode %s: %v", path, err)
+	}
+	return res.Code, body
+}
+
+func TestReadyzReportsEachCheck(t *testing.T) {
+	ok := Check{Name: "database", Run: func(context.Context) (map[string]any, error) {
+		return map[string]any{"idle": 1}, nil
+	}}
+	failing := Check{Name: "migrations", Run: func(context.Context) (map[string]any, error) {
+		return nil, errors.New("schema is at version 6, expected 7")
+	}}
+	router := NewRouter(user.NewHandler(nil), WithHealth(NewHealth(ok, failing)))
+
+	code, body := getHealth(t, router, "/readyz")
+	if code != http.StatusServiceUnavailable || body.Status != "not ready" {
+		t.Fatalf("expected 503 not ready, got %d %q", code, body.Status)
+	}
+	if body.Checks["database"].Status != "ok" || body.Checks["database"].Details["idle"] != float64(1) {
+		t.Fatalf("unexpected database result: %+v", body.Checks["database"])
+	}
+	if got := body.Checks["migrations"]; got.Status != "fail" || got.Error == "" {
+		t.Fatalf("unexpected migrations result: %+v", got)
+	}
+}
+
+func TestReadyzFailsOnShutdownWhileLivezStaysUp(t *testing.T) {
+	health := NewHealth()
+	router := NewRouter(user.NewHandler(nil), WithHealth(health))
+
+	if code, body := getHealth(t, router, "/readyz"); code != http.StatusOK || body.Status != "ready" {
+		t.Fatalf("expected 200 ready before shutdown, got %d %q", code, body.Status)
+	}
+
+	health.Shutdown()
+	if code, body := getHealth(t, router, "/readyz"); code != http.StatusServiceUnavailable || body.Checks["shutdown"].Status != "fail" {
+		t.Fatalf("expected 503 with failed shutdown check, got %d %+v", code, body)
+	}
+	if code, _ := getHealth(t, router, "/livez"); code != http.StatusOK {
+		t.Fatalf("expected livez to stay 200 during shutdown, got %d", code)
+	}
+}
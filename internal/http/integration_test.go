@@ -9,12 +9,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"go-crud/internal/auth"
 	dbMigrate "go-crud/internal/db"
-	db "go-crud/internal/db/sqlc"
 	httprouter "go-crud/internal/http"
+	"go-crud/internal/mail"
 	"go-crud/internal/user"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -51,7 +54,11 @@ func testDSN() string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", host, port, dbUser, dbPass, dbName, sslMode)
 }
 
-func TestUsersAPIIntegration(t *testing.T) {
+// openIntegrationDB migrates and truncates the test database. Tests are
+// skipped when no database is configured or reachable.
+func openIntegrationDB(t *testing.T) *sql.DB {
+	t.Helper()
+
 	dsn := testDSN()
 	if dsn == "" {
 		t.Skip("set TEST_DATABASE_URL or DB_* env vars to run integration tests")
@@ -61,7 +68,7 @@ func TestUsersAPIIntegration(t *testing.T) {
 	if err != nil {
 		t.Fatalf("open db: %v", err)
 	}
-	defer sqlDB.Close()
+	t.Cleanup(func() { sqlDB.Close() })
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -72,17 +79,31 @@ func TestUsersAPIIntegration(t *testing.T) {
 	if err := dbMigrate.Migrate(ctx, sqlDB); err != nil {
 		t.Fatalf("migrate: %v", err)
 	}
-	if _, err := sqlDB.ExecContext(ctx, "TRUNCATE TABLE users"); err != nil {
+	if _, err := sqlDB.ExecContext(ctx, "TRUNCATE TABLE users, user_audit, idempotency_keys, api_keys, user_passwords, sessions, email_verifications"); err != nil {
 		t.Fatalf("truncate users: %v", err)
 	}
+	return sqlDB
+}
+
+// setupIntegration serves the full router on a fresh test database.
+func setupIntegration(t *testing.T, opts ...httprouter.RouterOption) *httptest.Server {
+	t.Helper()
+	return serveIntegration(t, openIntegrationDB(t), opts...)
+}
 
-	queries := db.New(sqlDB)
-	repo := user.NewPostgresRepository(queries)
+func serveIntegration(t *testing.T, sqlDB *sql.DB, opts ...httprouter.RouterOption) *httptest.Server {
+	t.Helper()
+	repo := user.NewPostgresRepository(sqlDB)
 	svc := user.NewService(repo)
-	handler := user.NewHandler(svc)
-	router := httprouter.NewRouter(handler)
+	handler := user.NewHandler(svc, user.WithIdempotency(user.NewPostgresIdempotencyStore(sqlDB), time.Hour))
+	router := httprouter.NewRouter(handler, opts...)
 	server := httptest.NewServer(router)
-	defer server.Close()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUsersAPIIntegration(t *testing.T) {
+	server := setupIntegration(t)
 
 	createPayload := map[string]any{
 		"firstName": "John",
@@ -119,4 +140,430 @@ func TestUsersAPIIntegration(t *testing.T) {
 	if getResp.StatusCode != http.StatusOK {
 		t.Fatalf("expected 200 from get by id, got %d", getResp.StatusCode)
 	}
+
+	dupResp, err := http.Post(server.URL+"/users", "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("post duplicate /users: %v", err)
+	}
+	defer dupResp.Body.Close()
+	if dupResp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate email, got %d", dupResp.StatusCode)
+	}
+
+	delReq, _ := http.NewRequest(http.MethodDelete, server.URL+"/users/"+id, nil)
+	delResp, err := http.DefaultClient.Do(delReq)
+	if err != nil {
+		t.Fatalf("delete /users/{id}: %v", err)
+	}
+	delResp.Body.Close()
+	if delResp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 from delete, got %d", delResp.StatusCode)
+	}
+
+	goneResp, err := http.Get(server.URL + "/users/" + id)
+	if err != nil {
+		t.Fatalf("get deleted user: %v", err)
+	}
+	goneResp.Body.Close()
+	if goneResp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for soft-deleted user, got %d", goneResp.StatusCode)
+	}
+
+	restoreResp, err := http.Post(server.URL+"/users/"+id+"/restore", "application/json", nil)
+	if err != nil {
+		t.Fatalf("post /users/{id}/restore: %v", err)
+	}
+	restoreResp.Body.Close()
+	if restoreResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from restore, got %d", restoreResp.StatusCode)
+	}
+
+	auditResp, err := http.Get(server.URL + "/users/" + id + "/audit")
+	if err != nil {
+		t.Fatalf("get /users/{id}/audit: %v", err)
+	}
+	defer auditResp.Body.Close()
+	var audit struct {
+		Items []struct {
+			Action string `json:"action"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(auditResp.Body).Decode(&audit); err != nil {
+		t.Fatalf("decode audit response: %v", err)
+	}
+	var actions []string
+	for _, item := range audit.Items {
+		actions = append(actions, item.Action)
+	}
+	if fmt.Sprint(actions) != "[restore delete create]" {
+		t.Fatalf("unexpected audit trail: %v", actions)
+	}
+}
+
+func TestConcurrentPatchesDoNotLoseUpdates(t *testing.T) {
+	server := setupIntegration(t)
+
+	b, _ := json.Marshal(map[string]any{
+		"firstName": "Race",
+		"lastName":  "Condition",
+		"email":     "race.integration@example.com",
+	})
+	resp, err := http.Post(server.URL+"/users", "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("post /users: %v", err)
+	}
+	var created map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	id, _ := created["userId"].(string)
+	if id == "" {
+		t.Fatal("expected userId in create response")
+	}
+
+	// Each round patches every field concurrently from its own request. A
+	// read-merge-write race would let one request restore a stale value.
+	const rounds = 20
+	for round := 0; round < rounds; round++ {
+		patches := []map[string]any{
+			{"firstName": fmt.Sprintf("First%d", round)},
+			{"lastName": fmt.Sprintf("Last%d", round)},
+			{"phone": fmt.Sprintf("+1415555%04d", round)},
+			{"age": round + 1},
+		}
+
+		var wg sync.WaitGroup
+		for _, patch := range patches {
+			wg.Add(1)
+			go func(patch map[string]any) {
+				defer wg.Done()
+				body, _ := json.Marshal(patch)
+				req, _ := http.NewRequest(http.MethodPatch, server.URL+"/users/"+id, bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				res, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Errorf("patch: %v", err)
+					return
+				}
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					t.Errorf("expected 200 from patch, got %d", res.StatusCode)
+				}
+			}(patch)
+		}
+		wg.Wait()
+
+		getResp, err := http.Get(server.URL + "/users/" + id)
+		if err != nil {
+			t.Fatalf("get /users/{id}: %v", err)
+		}
+		var got map[string]any
+		_ = json.NewDecoder(getResp.Body).Decode(&got)
+		getResp.Body.Close()
+
+		want := map[string]any{
+			"firstName": fmt.Sprintf("First%d", round),
+			"lastName":  fmt.Sprintf("Last%d", round),
+			"phone":     fmt.Sprintf("+1415555%04d", round),
+			"age":       float64(round + 1),
+		}
+		for field, v := range want {
+			if got[field] != v {
+				t.Fatalf("round %d: lost update to %s: got %v, want %v", round, field, got[field], v)
+			}
+		}
+	}
+}
+
+func TestBatchCreateAndExportIntegration(t *testing.T) {
+	server := setupIntegration(t)
+
+	// Enough users to span several fetches from the export cursor.
+	const total = 2500
+	for start := 0; start < total; start += user.MaxBatchSize {
+		var ops []map[string]any
+		for i := start; i < min(start+user.MaxBatchSize, total); i++ {
+			ops = append(ops, map[string]any{
+				"op": "create",
+				"data": map[string]any{
+					"firstName": "Bulk",
+					"lastName":  fmt.Sprintf("User%d", i),
+					"email":     fmt.Sprintf("bulk%d@example.com", i),
+				},
+			})
+		}
+		b, _ := json.Marshal(map[string]any{"mode": "atomic", "operations": ops})
+		resp, err := http.Post(server.URL+"/users:batch", "application/json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("post /users:batch: %v", err)
+		}
+		var result struct {
+			Succeeded int `json:"succeeded"`
+			Failed    int `json:"failed"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || result.Failed != 0 || result.Succeeded != len(ops) {
+			t.Fatalf("batch failed: status %d, %+v", resp.StatusCode, result)
+		}
+	}
+
+	// A duplicate email in an atomic batch rolls back the whole batch.
+	b, _ := json.Marshal(map[string]any{"operations": []map[string]any{
+		{"op": "create", "data": map[string]any{"firstName": "New", "lastName": "User", "email": "new.batch@example.com"}},
+		{"op": "create", "data": map[string]any{"firstName": "Dup", "lastName": "User", "email": "bulk0@example.com"}},
+	}})
+	resp, err := http.Post(server.URL+"/users:batch", "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("post /users:batch: %v", err)
+	}
+	var rolledBack struct {
+		Results []struct {
+			Status int `json:"status"`
+		} `json:"results"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&rolledBack)
+	resp.Body.Close()
+	if len(rolledBack.Results) != 2 || rolledBack.Results[0].Status != http.StatusFailedDependency || rolledBack.Results[1].Status != http.StatusConflict {
+		t.Fatalf("unexpected atomic batch results: %+v", rolledBack.Results)
+	}
+
+	exportResp, err := http.Get(server.URL + "/users/export?format=ndjson&columns=email&emailDomain=example.com")
+	if err != nil {
+		t.Fatalf("get /users/export: %v", err)
+	}
+	defer exportResp.Body.Close()
+	if exportResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from export, got %d", exportResp.StatusCode)
+	}
+	lines := 0
+	dec := json.NewDecoder(exportResp.Body)
+	for dec.More() {
+		var row map[string]string
+		if err := dec.Decode(&row); err != nil {
+			t.Fatalf("decode export row %d: %v", lines, err)
+		}
+		if row["email"] == "new.batch@example.com" {
+			t.Fatal("export includes a user from a rolled-back batch")
+		}
+		lines++
+	}
+	if lines != total {
+		t.Fatalf("expected %d exported users, got %d", total, lines)
+	}
+}
+
+func TestImportIntegration(t *testing.T) {
+	server := setupIntegration(t)
+
+	b, _ := json.Marshal(map[string]any{"firstName": "Existing", "lastName": "User", "email": "existing.import@example.com"})
+	resp, err := http.Post(server.URL+"/users", "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("post /users: %v", err)
+	}
+	resp.Body.Close()
+
+	csvBody := "firstName,lastName,email,age\n" +
+		"New,Hire,new.import@example.com,30\n" +
+		"Existing,User,existing.import@example.com,\n" +
+		"Bad,Row,not-an-email,\n"
+
+	for _, dryRun := range []bool{true, false} {
+		resp, err := http.Post(fmt.Sprintf("%s/users/import?dryRun=%v", server.URL, dryRun), "text/csv", bytes.NewBufferString(csvBody))
+		if err != nil {
+			t.Fatalf("post /users/import: %v", err)
+		}
+		var report struct {
+			Created  int `json:"created"`
+			Skipped  int `json:"skipped"`
+			Rejected int `json:"rejected"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&report)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || report.Created != 1 || report.Skipped != 1 || report.Rejected != 1 {
+			t.Fatalf("dryRun=%v: unexpected import result: status %d, %+v", dryRun, resp.StatusCode, report)
+		}
+	}
+
+	listResp, err := http.Get(server.URL + "/users?emailDomain=example.com")
+	if err != nil {
+		t.Fatalf("get /users: %v", err)
+	}
+	defer listResp.Body.Close()
+	var page struct {
+		Items []map[string]any `json:"items"`
+	}
+	_ = json.NewDecoder(listResp.Body).Decode(&page)
+	if len(page.Items) != 2 {
+		t.Fatalf("expected the dry run to create nothing and the import one user, got %d users", len(page.Items))
+	}
+}
+
+func TestIdempotentCreateIntegration(t *testing.T) {
+	server := setupIntegration(t)
+
+	post := func(key, body string) (*http.Response, string) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/users", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post /users: %v", err)
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(resp.Body)
+		return resp, buf.String()
+	}
+	body := `{"firstName":"Retry","lastName":"Client","email":"retry.integration@example.com"}`
+
+	first, firstBody := post("retry-1", body)
+	if first.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", first.StatusCode)
+	}
+	again, againBody := post("retry-1", body)
+	if again.StatusCode != http.StatusCreated || againBody != firstBody || again.Header.Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected replayed 201, got %d %s", again.StatusCode, againBody)
+	}
+	if other, _ := post("retry-1", `{"firstName":"Other","lastName":"Body","email":"other.integration@example.com"}`); other.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for reused key, got %d", other.StatusCode)
+	}
+}
+
+func TestAPIKeyAuthIntegration(t *testing.T) {
+	sqlDB := openIntegrationDB(t)
+	keys := auth.NewPostgresAPIKeyStore(sqlDB)
+	server := serveIntegration(t, sqlDB, httprouter.WithAuth(keys), httprouter.WithAPIKeyAdmin(auth.NewAPIKeyHandler(keys)))
+
+	ctx := context.Background()
+	_, adminKey, err := keys.Create(ctx, "bootstrap", []string{auth.ScopeUsersAdmin})
+	if err != nil {
+		t.Fatalf("create admin key: %v", err)
+	}
+
+	do := func(method, path, key, body string) (*http.Response, []byte) {
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(resp.Body)
+		return resp, buf.Bytes()
+	}
+
+	if resp, _ := do(http.MethodGet, "/users", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a key, got %d", resp.StatusCode)
+	}
+
+	resp, body := do(http.MethodPost, "/admin/api-keys", adminKey, `{"name":"reporting","scopes":["users:read"]}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 creating key, got %d: %s", resp.StatusCode, body)
+	}
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+
+	if resp, _ := do(http.MethodGet, "/users", created.Key, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected reader to list users, got %d", resp.StatusCode)
+	}
+	if resp, _ := do(http.MethodPost, "/users", created.Key, `{"firstName":"Read","lastName":"Only","email":"read.only@example.com"}`); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected reader to be forbidden from creating, got %d", resp.StatusCode)
+	}
+
+	resp, body = do(http.MethodPost, "/admin/api-keys/"+created.ID+"/rotate", adminKey, "")
+	var rotated struct {
+		Key        string     `json:"key"`
+		LastUsedAt *time.Time `json:"lastUsedAt"`
+	}
+	if err := json.Unmarshal(body, &rotated); err != nil || resp.StatusCode != http.StatusOK || rotated.LastUsedAt == nil {
+		t.Fatalf("expected rotated key with last use recorded, got %d: %s", resp.StatusCode, body)
+	}
+	if resp, _ := do(http.MethodGet, "/users", created.Key, ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected old secret rejected after rotation, got %d", resp.StatusCode)
+	}
+
+	if resp, _ := do(http.MethodDelete, "/admin/api-keys/"+created.ID, adminKey, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 revoking key, got %d", resp.StatusCode)
+	}
+	if resp, _ := do(http.MethodGet, "/users", rotated.Key, ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected revoked key rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestEmailVerificationIntegration(t *testing.T) {
+	sqlDB := openIntegrationDB(t)
+	mailer := mail.NewMemoryMailer()
+	svc := user.NewService(user.NewPostgresRepository(sqlDB),
+		user.WithEmailVerification(mailer, "https://app.example.com/verify", time.Hour))
+	server := httptest.NewServer(httprouter.NewRouter(user.NewHandler(svc)))
+	t.Cleanup(server.Close)
+
+	post := func(path, body string) *http.Response {
+		resp, err := http.Post(server.URL+path, "application/json", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("post %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	lastToken := func() string {
+		msgs := mailer.Messages()
+		if len(msgs) == 0 {
+			t.Fatal("expected a verification email")
+		}
+		_, token, ok := strings.Cut(msgs[len(msgs)-1].Text, "?token=")
+		if !ok {
+			t.Fatalf("no token in %q", msgs[len(msgs)-1].Text)
+		}
+		token, _, _ = strings.Cut(token, "\n")
+		return token
+	}
+
+	resp, err := http.Post(server.URL+"/users", "application/json",
+		bytes.NewBufferString(`{"firstName":"Ada","lastName":"Lovelace","email":"ada.verify@example.com"}`))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	var created user.User
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	resp.Body.Close()
+	firstToken := lastToken()
+
+	// Changing the email sends a new token and voids the old one.
+	req, _ := http.NewRequest(http.MethodPatch, server.URL+"/users/"+created.UserID.String(),
+		bytes.NewBufferString(`{"email":"ada.lovelace@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("patch email: %v %v", resp, err)
+	}
+	if resp := post("/users/verify-email", `{"token":"`+firstToken+`"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected the old token to be rejected, got %d", resp.StatusCode)
+	}
+
+	token := lastToken()
+	if resp := post("/users/verify-email", `{"token":"`+token+`"}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 verifying, got %d", resp.StatusCode)
+	}
+	if resp := post("/users/verify-email", `{"token":"`+token+`"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a used token to be rejected, got %d", resp.StatusCode)
+	}
+
+	got, err := svc.GetByID(context.Background(), created.UserID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.EmailVerifiedAt == nil || got.Email != "ada.lovelace@example.com" {
+		t.Fatalf("expected the new email to be verified, got %+v", got)
+	}
 }
@@ -6,21 +6,88 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"go-crud/internal/auth"
 	"go-crud/internal/docs"
+	"go-crud/internal/logging"
+	"go-crud/internal/metrics"
+	"go-crud/internal/problem"
+	"go-crud/internal/tracing"
 	"go-crud/internal/user"
 )
 
-func NewRouter(userHandler *user.Handler) http.Handler {
+// RouterOption configures NewRouter.
+type RouterOption func(*routerConfig)
+
+type routerConfig struct {
+	health         *Health
+	metrics        *metrics.Metrics
+	authenticators []auth.Authenticator
+	apiKeys        *auth.APIKeyHandler
+	sessions       *auth.SessionHandler
+}
+
+// WithHealth serves /livez and /readyz from h. Without it, /readyz checks
+// nothing but shutdown.
+func WithHealth(h *Health) RouterOption {
+	return func(c *routerConfig) { c.health = h }
+}
+
+// WithMetrics records request metrics with m and serves them on /metrics.
+func WithMetrics(m *metrics.Metrics) RouterOption {
+	return func(c *routerConfig) { c.metrics = m }
+}
+
+// WithAuth requires every user and admin route to carry a bearer token
+// accepted by one of authenticators, with the scope the route needs.
+func WithAuth(authenticators ...auth.Authenticator) RouterOption {
+	return func(c *routerConfig) { c.authenticators = authenticators }
+}
+
+// WithAPIKeyAdmin serves the API key admin endpoints from h. It requires
+// WithAuth, since the endpoints must never be open.
+func WithAPIKeyAdmin(h *auth.APIKeyHandler) RouterOption {
+	return func(c *routerConfig) { c.apiKeys = h }
+}
+
+// WithSessions serves the open /auth/login and /auth/logout endpoints from
+// h. The session store must also be passed to WithAuth for the tokens it
+// issues to be accepted.
+func WithSessions(h *auth.SessionHandler) RouterOption {
+	return func(c *routerConfig) { c.sessions = h }
+}
+
+func NewRouter(userHandler *user.Handler, opts ...RouterOption) http.Handler {
+	cfg := routerConfig{health: NewHealth()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.apiKeys != nil && len(cfg.authenticators) == 0 {
+		panic("http: WithAPIKeyAdmin requires WithAuth")
+	}
+
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(tracing.Middleware)
+	if cfg.metrics != nil {
+		// Outside Recoverer, so that panics are counted as 500s.
+		r.Use(cfg.metrics.Middleware)
+	}
+	r.Use(logging.Middleware)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Logger)
 
-	r.Get("/health", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok"))
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.New(http.StatusNotFound, "no route for "+r.URL.Path))
 	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.New(http.StatusMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path))
+	})
+
+	r.Get("/livez", cfg.health.Live)
+	r.Get("/readyz", cfg.health.Ready)
+	if cfg.metrics != nil {
+		r.Method(http.MethodGet, "/metrics", cfg.metrics.Handler())
+	}
 
 	r.Get("/doc", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/doc/", http.StatusMovedPermanently)
@@ -30,6 +97,35 @@ func NewRouter(userHandler *user.Handler) http.Handler {
 		http.ServeFile(w, r, "docs/openapi.yaml")
 	})
 
-	userHandler.RegisterRoutes(r)
+	if cfg.sessions != nil {
+		cfg.sessions.RegisterRoutes(r)
+	}
+	userHandler.RegisterPublicRoutes(r)
+
+	r.Group(func(r chi.Router) {
+		if len(cfg.authenticators) > 0 {
+			r.Use(authenticate(cfg.authenticators))
+			r.Use(requireScope)
+		} else {
+			r.Use(actorFromHeader)
+		}
+		userHandler.RegisterRoutes(r)
+		if cfg.apiKeys != nil {
+			cfg.apiKeys.RegisterRoutes(r)
+		}
+	})
 	return r
 }
+
+// actorFromHeader attributes audited mutations to the X-Actor header set by
+// the upstream gateway. It is trusted only on the user routes of a router
+// without authentication, where the gateway is the only way in; open routes
+// such as email verification never read it.
+func actorFromHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actor := r.Header.Get("X-Actor"); actor != "" {
+			r = r.WithContext(user.WithActor(r.Context(), actor))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-crud/internal/auth"
+	"go-crud/internal/user"
+)
+
+// actorRepo is a user.Repository holding one user, verifiable with any
+// token, that records the actor of each audit record. Methods the tests do
+// not reach are left to the nil embedded interface.
+type actorRepo struct {
+	user.Repository
+	u      user.User
+	actors []string
+}
+
+func (r *actorRepo) WithTx(_ context.Context, fn func(tx user.Repository) error) error {
+	return fn(r)
+}
+
+func (r *actorRepo) GetForUpdate(context.Context, uuid.UUID, bool) (user.User, error) {
+	return r.u, nil
+}
+
+func (r *actorRepo) Delete(context.Context, uuid.UUID, int64) error {
+	return nil
+}
+
+func (r *actorRepo) ConsumeEmailVerification(context.Context, []byte) (user.EmailVerification, error) {
+	return user.EmailVerification{UserID: r.u.UserID, Email: r.u.Email, ExpiresAt: time.Now().Add(time.Hour)}, nil
+}
+
+func (r *actorRepo) MarkEmailVerified(context.Context, uuid.UUID, string) (user.User, error) {
+	return r.u, nil
+}
+
+func (r *actorRepo) RecordAudit(_ context.Context, rec user.AuditRecord) error {
+	r.actors = append(r.actors, rec.Actor)
+	return nil
+}
+
+func TestActorHeader(t *testing.T) {
+	authn := tokenAuthenticator{"test_admin": {Subject: "apikey:admin", Scopes: []string{auth.ScopeUsersAdmin}}}
+	tests := []struct {
+		name, method, path, token string
+		opts                      []RouterOption
+		want                      string
+	}{
+		{"trusted without auth", http.MethodDelete, "/users/{id}", "", nil, "gateway"},
+		{"replaced by principal", http.MethodDelete, "/users/{id}", "test_admin", []RouterOption{WithAuth(authn)}, "apikey:admin"},
+		{"ignored on verify-email without auth", http.MethodPost, "/users/verify-email", "", nil, user.AnonymousActor},
+		{"ignored on verify-email with auth", http.MethodPost, "/users/verify-email", "", []RouterOption{WithAuth(authn)}, user.AnonymousActor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &actorRepo{u: user.User{UserID: uuid.New(), Email: "ada@example.com", Status: user.StatusActive}}
+			router := NewRouter(user.NewHandler(user.NewService(repo)), tt.opts...)
+
+			path := strings.Replace(tt.path, "{id}", repo.u.UserID.String(), 1)
+			req := httptest.NewRequest(tt.method, path, strings.NewReader(`{"token":"anything"}`))
+			req.Header.Set("X-Actor", "gateway")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			if res.Code != http.StatusNoContent {
+				t.Fatalf("expected 204, got %d: %s", res.Code, res.Body)
+			}
+			if len(repo.actors) != 1 || repo.actors[0] != tt.want {
+				t.Fatalf("expected actor %q, got %v", tt.want, repo.actors)
+			}
+		})
+	}
+}
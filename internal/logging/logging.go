@@ -0,0 +1,103 @@
+// Package logging configures structured JSON logging with log/slog and
+// annotates log records with the request they were written for.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+
+	"go-crud/internal/config"
+)
+
+// Redacted replaces the value of PII attributes.
+const Redacted = "[REDACTED]"
+
+// piiKeys are attribute keys whose values are redacted, matched without
+// regard to case or group.
+var piiKeys = map[string]bool{"email": true, "phone": true}
+
+// New returns a logger writing JSON to w at cfg.Level. Records logged with a
+// request context carry its request ID, route, user ID, latency and trace ID.
+func New(w io.Writer, cfg config.Logging) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	if cfg.RedactPII {
+		opts.ReplaceAttr = redactPII
+	}
+	return slog.New(&contextHandler{Handler: slog.NewJSONHandler(w, opts)})
+}
+
+func redactPII(_ []string, a slog.Attr) slog.Attr {
+	if piiKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// requestState is shared between Middleware and the log records written
+// while it handles a request.
+type requestState struct {
+	start  time.Time
+	userID string
+}
+
+type requestStateKey struct{}
+
+// SetUserID attributes the rest of the request's log records to the user
+// with the given ID, for routes that do not carry it in the path.
+func SetUserID(ctx context.Context, id string) {
+	if st, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
+		st.userID = id
+	}
+}
+
+// contextHandler adds the request attributes found in the record's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := middleware.GetReqID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if route := rctx.RoutePattern(); route != "" {
+			r.AddAttrs(slog.String("route", route))
+		}
+	}
+	if st, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
+		userID := st.userID
+		if rctx := chi.RouteContext(ctx); userID == "" && rctx != nil && isUserRoute(rctx.RoutePattern()) {
+			userID = rctx.URLParam("id")
+		}
+		if userID != "" {
+			r.AddAttrs(slog.String("user_id", userID))
+		}
+		r.AddAttrs(slog.Float64("latency_ms", float64(time.Since(st.start).Microseconds())/1000))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// isUserRoute reports whether route addresses a single user by its ID, as
+// opposed to another resource that also has an {id} parameter.
+func isUserRoute(route string) bool {
+	rest, ok := strings.CutPrefix(route, "/users/{id}")
+	return ok && (rest == "" || strings.HasPrefix(rest, "/"))
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"go-crud/internal/config"
+)
+
+// captureDefault routes the default logger to a buffer for the test.
+func captureDefault(t *testing.T, cfg config.Logging) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(New(&buf, cfg))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestRedactsPIIByDefault(t *testing.T) {
+	buf := captureDefault(t, config.Logging{Level: slog.LevelInfo, RedactPII: true})
+	slog.Info("created", "email", "ada@example.com", slog.Group("user", "Phone", "+14155552671"), "status", "Active")
+
+	line := buf.String()
+	if strings.Contains(line, "ada@example.com") || strings.Contains(line, "+14155552671") {
+		t.Fatalf("expected PII redacted, got %s", line)
+	}
+	if !strings.Contains(line, `"status":"Active"`) {
+		t.Fatalf("expected other attributes kept, got %s", line)
+	}
+}
+
+func TestRequestRecordsCarryRequestContext(t *testing.T) {
+	buf := captureDefault(t, config.Logging{Level: slog.LevelInfo})
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(Middleware)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		slog.ErrorContext(r.Context(), "request failed", "error", "boom")
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42?q=secret", nil))
+
+	lines := decodeLines(t, buf)
+	if len(lines) != 2 {
+		t.Fatalf("expected error and access records, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if line["request_id"] == nil || line["route"] != "/users/{id}" || line["user_id"] != "42" || line["latency_ms"] == nil {
+			t.Fatalf("missing request attributes in %v", line)
+		}
+	}
+	access := lines[1]
+	if access["msg"] != "request" || access["status"] != float64(500) || access["path"] != "/users/42" {
+		t.Fatalf("unexpected access record %v", access)
+	}
+}
+
+func TestUserIDOnlyFromUserRoutes(t *testing.T) {
+	buf := captureDefault(t, config.Logging{Level: slog.LevelInfo})
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Delete("/admin/api-keys/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.Post("/users/{id}/password", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/admin/api-keys/7", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users/42/password", nil))
+
+	lines := decodeLines(t, buf)
+	if len(lines) != 2 {
+		t.Fatalf("expected two access records, got %d", len(lines))
+	}
+	if id, ok := lines[0]["user_id"]; ok {
+		t.Fatalf("expected no user_id for an API key route, got %v", id)
+	}
+	if lines[1]["user_id"] != "42" {
+		t.Fatalf("expected user_id 42, got %v", lines[1])
+	}
+}
+
+func TestLevelFiltersRecords(t *testing.T) {
+	buf := captureDefault(t, config.Logging{Level: slog.LevelWarn})
+	slog.Info("hidden")
+	slog.Warn("shown")
+
+	if lines := decodeLines(t, buf); len(lines) != 1 || lines[0]["msg"] != "shown" {
+		t.Fatalf("expected only the warning, got %v", lines)
+	}
+}
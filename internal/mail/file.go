@@ -0,0 +1,56 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer drops each message into a directory as an .eml file, for local
+// development and for pickup by another process. Files appear complete:
+// each is written under a temporary name and then renamed.
+type FileMailer struct {
+	dir  string
+	from *mail.Address
+}
+
+// NewFileMailer writes messages from from into dir, which is created on the
+// first send if needed.
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	sender, err := parseAddress(from)
+	if err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: sender}, nil
+}
+
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	now := time.Now()
+	body, err := render(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0o750); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000Z"), hex.EncodeToString(suffix))
+	tmp := filepath.Join(m.dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, body, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(m.dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
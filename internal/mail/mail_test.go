@@ -0,0 +1,213 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMessage = Message{
+	To:      "Ada Lovelace <ada@example.com>",
+	Subject: "Vérifiez votre adresse",
+	Text:    "Hello Ada,\nfollow this link: https://example.com/verify?token=abc\n",
+}
+
+// parseRendered parses a rendered message and decodes its body.
+func parseRendered(t *testing.T, raw []byte) (*mail.Message, string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return msg, string(body)
+}
+
+func TestRender(t *testing.T) {
+	from, _ := parseAddress("go-crud <no-reply@example.com>")
+	raw, err := render(from, testMessage, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	msg, _ := parseRendered(t, raw)
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != testMessage.Subject {
+		t.Fatalf("expected subject %q, got %q (%v)", testMessage.Subject, subject, err)
+	}
+	if to := msg.Header.Get("To"); to != `"Ada Lovelace" <ada@example.com>` {
+		t.Fatalf("unexpected To %q", to)
+	}
+	if id := msg.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Fatalf("unexpected Message-ID %q", id)
+	}
+	if !strings.Contains(string(raw), "\r\nfollow this link: https://example.com/verify?token=3Dabc\r\n") {
+		t.Fatalf("expected a quoted-printable body with CRLF line endings, got %q", raw)
+	}
+}
+
+func TestRenderRejectsHeaderInjection(t *testing.T) {
+	from, _ := parseAddress("no-reply@example.com")
+	for _, to := range []string{"", "not an address", "ada@example.com\r\nBcc: eve@example.com", "ada@example.com, bob@example.com"} {
+		msg := testMessage
+		msg.To = to
+		if _, err := render(from, msg, time.Now()); !errors.Is(err, ErrInvalidAddress) {
+			t.Fatalf("%q: expected ErrInvalidAddress, got %v", to, err)
+		}
+	}
+
+	msg := testMessage
+	msg.Subject = "Hi\r\nBcc: eve@example.com"
+	raw, err := render(from, msg, time.Now())
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if parsed, _ := parseRendered(t, raw); parsed.Header.Get("Bcc") != "" {
+		t.Fatal("subject injected a header")
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+	if err := m.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := m.Send(context.Background(), Message{To: "nobody"}); !errors.Is(err, ErrInvalidAddress) {
+		t.Fatalf("expected ErrInvalidAddress, got %v", err)
+	}
+	if got := m.Messages(); len(got) != 1 || got[0] != testMessage {
+		t.Fatalf("unexpected messages %+v", got)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	m, err := NewFileMailer(dir, "no-reply@example.com")
+	if err != nil {
+		t.Fatalf("new mailer: %v", err)
+	}
+	for range 2 {
+		if err := m.Send(context.Background(), testMessage); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected two .eml files, got %v (%v)", files, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Fatalf("expected no temporary files to remain, got %d entries", len(entries))
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	msg, body := parseRendered(t, raw)
+	if msg.Header.Get("From") != "<no-reply@example.com>" || !strings.Contains(body, "token=") {
+		t.Fatalf("unexpected message %v %q", msg.Header, body)
+	}
+}
+
+func TestNewMailersRejectBadConfig(t *testing.T) {
+	if _, err := NewFileMailer(t.TempDir(), "no-reply"); !errors.Is(err, ErrInvalidAddress) {
+		t.Fatalf("expected ErrInvalidAddress, got %v", err)
+	}
+	if _, err := NewSMTPMailer("localhost", "", "", "no-reply@example.com"); err == nil {
+		t.Fatal("expected an address without a port to be rejected")
+	}
+}
+
+// fakeSMTP accepts one message without TLS or authentication and returns
+// what it received.
+func fakeSMTP(t *testing.T) (addr string, received <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+
+		var transcript strings.Builder
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			transcript.WriteString(line)
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250-fake")
+				reply("250 8BITMIME")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				ch <- transcript.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return l.Addr().String(), ch
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	m, err := NewSMTPMailer(addr, "", "", "go-crud <no-reply@example.com>")
+	if err != nil {
+		t.Fatalf("new mailer: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, testMessage); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	select {
+	case got := <-received:
+		for _, want := range []string{"MAIL FROM:<no-reply@example.com>", "RCPT TO:<ada@example.com>", "Subject: =?utf-8?q?", "token=3Dabc"} {
+			if !strings.Contains(got, want) {
+				t.Fatalf("expected %q in transcript:\n%s", want, got)
+			}
+		}
+	case <-ctx.Done():
+		t.Fatal("server received nothing")
+	}
+}
@@ -0,0 +1,135 @@
+// Package metrics exposes Prometheus metrics for the HTTP API, the user
+// repository and the database.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	db "go-crud/internal/db/sqlc"
+)
+
+// Metrics owns a registry holding the Go runtime and process collectors and
+// the metrics recorded by Middleware and NewRepository.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	queryDuration   *prometheus.HistogramVec
+	queryErrors     *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by method, chi route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method, chi route pattern and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "repository_call_duration_seconds",
+			Help:    "Duration of user repository calls by method.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "repository_call_errors_total",
+			Help: "User repository calls that returned an error, by method.",
+		}, []string{"method"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.queryDuration, m.queryErrors,
+	)
+	return m
+}
+
+// RegisterDB adds connection pool gauges and a users-by-status gauge read
+// from conn at scrape time.
+func (m *Metrics) RegisterDB(conn *sql.DB) error {
+	if err := m.registry.Register(collectors.NewDBStatsCollector(conn, "users")); err != nil {
+		return err
+	}
+	return m.registry.Register(&userCollector{q: db.New(conn)})
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware records the count and latency of every request. Requests are
+// labelled by the matched route pattern rather than the path, so that IDs do
+// not multiply the series; unmatched requests share the "unmatched" route.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			labels := prometheus.Labels{"method": r.Method, "route": route, "status": strconv.Itoa(status)}
+			m.requests.With(labels).Inc()
+			m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// observe records one repository call. It takes the call's named error
+// result by pointer so that it can be deferred at the start of the call.
+func (m *Metrics) observe(method string, start time.Time, err *error) {
+	m.queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		m.queryErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// userCollectTimeout bounds the users-by-status query run on each scrape.
+const userCollectTimeout = 5 * time.Second
+
+var usersDesc = prometheus.NewDesc("users", "Users by status, counting soft-deleted users separately.", []string{"status", "deleted"}, nil)
+
+// userCollector counts users when scraped, so that the gauge is exact
+// however many replicas serve the API.
+type userCollector struct {
+	q *db.Queries
+}
+
+func (c *userCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- usersDesc
+}
+
+func (c *userCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), userCollectTimeout)
+	defer cancel()
+
+	rows, err := c.q.CountUsersByStatus(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(usersDesc, err)
+		return
+	}
+	for _, row := range rows {
+		ch <- prometheus.MustNewConstMetric(usersDesc, prometheus.GaugeValue, float64(row.Count), row.Status, strconv.FormatBool(row.Deleted))
+	}
+}
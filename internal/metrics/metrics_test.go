@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"go-crud/internal/user"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	res := httptest.NewRecorder()
+	m.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read metrics: %v", err)
+	}
+	return string(b)
+}
+
+func TestMiddlewareLabelsByRoutePattern(t *testing.T) {
+	m := New()
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/users/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/users/{id}",status="404"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/users/{id}",status="404"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in:\n%s", want, out)
+		}
+	}
+}
+
+// fakeRepo implements only the methods the test calls.
+type fakeRepo struct {
+	user.Repository
+}
+
+func (fakeRepo) GetByID(context.Context, uuid.UUID) (user.User, error) {
+	return user.User{}, user.ErrNotFound
+}
+
+func (f fakeRepo) WithTx(_ context.Context, fn func(tx user.Repository) error) error {
+	return fn(f)
+}
+
+func TestRepositoryRecordsCallsInsideTransactions(t *testing.T) {
+	m := New()
+	repo := NewRepository(fakeRepo{}, m)
+
+	err := repo.WithTx(context.Background(), func(tx user.Repository) error {
+		_, err := tx.GetByID(context.Background(), uuid.New())
+		return err
+	})
+	if !errors.Is(err, user.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`repository_call_duration_seconds_count{method="GetByID"} 1`,
+		`repository_call_errors_total{method="GetByID"} 1`,
+		`repository_call_errors_total{method="WithTx"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in:\n%s", want, out)
+		}
+	}
+}
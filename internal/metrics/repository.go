@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-crud/internal/user"
+)
+
+// repository decorates a user.Repository with call durations and error
+// counts. Repositories handed to transaction callbacks are decorated too.
+type repository struct {
+	next user.Repository
+	m    *Metrics
+}
+
+// NewRepository returns next instrumented with m.
+func NewRepository(next user.Repository, m *Metrics) user.Repository {
+	return &repository{next: next, m: m}
+}
+
+func (r *repository) Create(ctx context.Context, input user.CreateUserRequest) (_ user.User, err error) {
+	defer r.m.observe("Create", time.Now(), &err)
+	return r.next.Create(ctx, input)
+}
+
+func (r *repository) GetByID(ctx context.Context, id uuid.UUID) (_ user.User, err error) {
+	defer r.m.observe("GetByID", time.Now(), &err)
+	return r.next.GetByID(ctx, id)
+}
+
+func (r *repository) List(ctx context.Context, opts user.ListOptions) (_ user.Page, err error) {
+	defer r.m.observe("List", time.Now(), &err)
+	return r.next.List(ctx, opts)
+}
+
+func (r *repository) Search(ctx context.Context, query string, limit int) (_ []user.SearchResult, err error) {
+	defer r.m.observe("Search", time.Now(), &err)
+	return r.next.Search(ctx, query, limit)
+}
+
+func (r *repository) Export(ctx context.Context, f user.Filter, sort []user.SortField, fn func(user.User) error) (err error) {
+	defer r.m.observe("Export", time.Now(), &err)
+	return r.next.Export(ctx, f, sort, fn)
+}
+
+func (r *repository) Update(ctx context.Context, id uuid.UUID, input user.UpdateUserRequest, expectedVersion int64) (_ user.User, err error) {
+	defer r.m.observe("Update", time.Now(), &err)
+	return r.next.Update(ctx, id, input, expectedVersion)
+}
+
+func (r *repository) Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) (err error) {
+	defer r.m.observe("Delete", time.Now(), &err)
+	return r.next.Delete(ctx, id, expectedVersion)
+}
+
+func (r *repository) Restore(ctx context.Context, id uuid.UUID) (_ user.User, err error) {
+	defer r.m.observe("Restore", time.Now(), &err)
+	return r.next.Restore(ctx, id)
+}
+
+func (r *repository) BulkCreate(ctx context.Context, inputs []user.CreateUserRequest) (_ []user.User, err error) {
+	defer r.m.observe("BulkCreate", time.Now(), &err)
+	return r.next.BulkCreate(ctx, inputs)
+}
+
+func (r *repository) PurgeDeleted(ctx context.Context, before time.Time) (_ int64, err error) {
+	defer r.m.observe("PurgeDeleted", time.Now(), &err)
+	return r.next.PurgeDeleted(ctx, before)
+}
+
+func (r *repository) GetByEmail(ctx context.Context, email string) (_ user.User, err error) {
+	defer r.m.observe("GetByEmail", time.Now(), &err)
+	return r.next.GetByEmail(ctx, email)
+}
+
+func (r *repository) GetPasswordHash(ctx context.Context, id uuid.UUID) (_ string, err error) {
+	defer r.m.observe("GetPasswordHash", time.Now(), &err)
+	return r.next.GetPasswordHash(ctx, id)
+}
+
+func (r *repository) SetPasswordHash(ctx context.Context, id uuid.UUID, hash string) (err error) {
+	defer r.m.observe("SetPasswordHash", time.Now(), &err)
+	return r.next.SetPasswordHash(ctx, id, hash)
+}
+
+func (r *repository) DeleteSessions(ctx context.Context, id uuid.UUID) (_ int64, err error) {
+	defer r.m.observe("DeleteSessions", time.Now(), &err)
+	return r.next.DeleteSessions(ctx, id)
+}
+
+func (r *repository) ReplaceEmailVerification(ctx context.Context, v user.EmailVerification) (err error) {
+	defer r.m.observe("ReplaceEmailVerification", time.Now(), &err)
+	return r.next.ReplaceEmailVerification(ctx, v)
+}
+
+func (r *repository) ConsumeEmailVerification(ctx context.Context, tokenHash []byte) (_ user.EmailVerification, err error) {
+	defer r.m.observe("ConsumeEmailVerification", time.Now(), &err)
+	return r.next.ConsumeEmailVerification(ctx, tokenHash)
+}
+
+func (r *repository) MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) (_ user.User, err error) {
+	defer r.m.observe("MarkEmailVerified", time.Now(), &err)
+	return r.next.MarkEmailVerified(ctx, id, email)
+}
+
+func (r *repository) PurgeEmailVerifications(ctx context.Context) (_ int64, err error) {
+	defer r.m.observe("PurgeEmailVerifications", time.Now(), &err)
+	return r.next.PurgeEmailVerifications(ctx)
+}
+
+func (r *repository) GetForUpdate(ctx context.Context, id uuid.UUID, includeDeleted bool) (_ user.User, err error) {
+	defer r.m.observe("GetForUpdate", time.Now(), &err)
+	return r.next.GetForUpdate(ctx, id, includeDeleted)
+}
+
+func (r *repository) RecordAudit(ctx context.Context, rec user.AuditRecord) (err error) {
+	defer r.m.observe("RecordAudit", time.Now(), &err)
+	return r.next.RecordAudit(ctx, rec)
+}
+
+func (r *repository) ListAudit(ctx context.Context, q user.AuditQuery) (_ user.AuditPage, err error) {
+	defer r.m.observe("ListAudit", time.Now(), &err)
+	return r.next.ListAudit(ctx, q)
+}
+
+// WithTx and RunBatch time the whole transaction, including the calls made
+// inside it, which are also recorded on their own.
+func (r *repository) WithTx(ctx context.Context, fn func(tx user.Repository) error) (err error) {
+	defer r.m.observe("WithTx", time.Now(), &err)
+	return r.next.WithTx(ctx, func(tx user.Repository) error {
+		return fn(&repository{next: tx, m: r.m})
+	})
+}
+
+func (r *repository) RunBatch(ctx context.Context, n int, atomic bool, fn func(tx user.Repository, i int) error) (_ []error, err error) {
+	defer r.m.observe("RunBatch", time.Now(), &err)
+	return r.next.RunBatch(ctx, n, atomic, func(tx user.Repository, i int) error {
+		return fn(&repository{next: tx, m: r.m}, i)
+	})
+}
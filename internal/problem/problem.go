@@ -0,0 +1,104 @@
+// Package problem writes RFC 7807 application/problem+json error responses.
+package problem
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem types for errors clients are expected to handle programmatically.
+// Other problems use "about:blank" and are identified by their status.
+const (
+	TypeBlank      = "about:blank"
+	TypeValidation = "/problems/validation-error"
+)
+
+// Problem is an RFC 7807 problem details object. Code is an extension member
+// carrying a stable machine-readable error code; Rule names the
+// authorization rule that denied a request.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code,omitempty"`
+	Rule     string       `json:"rule,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid request field, named as in the JSON
+// payload.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// New returns a problem of type about:blank titled after status.
+func New(status int, detail string) *Problem {
+	return &Problem{Type: TypeBlank, Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// WithCode sets the type and code of p to identify a specific error.
+func (p *Problem) WithCode(typ, code string) *Problem {
+	p.Type = typ
+	p.Code = code
+	return p
+}
+
+// Validation returns a 400 problem listing every failed validation rule.
+func Validation(errs validator.ValidationErrors) *Problem {
+	p := New(http.StatusBadRequest, "request validation failed")
+	p.Type = TypeValidation
+	p.Errors = make([]FieldError, 0, len(errs))
+	for _, fe := range errs {
+		p.Errors = append(p.Errors, FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: message(fe),
+		})
+	}
+	return p
+}
+
+// Write sends p with the request ID assigned by chi's RequestID middleware as
+// its instance.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = middleware.GetReqID(r.Context())
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// message renders a human-readable sentence for one failed rule. Fields are
+// reported by their JSON names when the validator is configured to use them.
+func message(fe validator.FieldError) string {
+	field := fe.Field()
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", field, fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", field, fe.Param())
+	case "email":
+		return field + " must be a valid email address"
+	case "e164":
+		return field + " must be an E.164 phone number such as +14155552671"
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, fe.Param())
+	default:
+		return fmt.Sprintf("%s failed the %s rule", field, fe.Tag())
+	}
+}
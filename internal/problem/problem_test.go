@@ -0,0 +1,35 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestWriteSetsContentTypeAndInstance(t *testing.T) {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, New(http.StatusConflict, "already exists").WithCode("/problems/conflict", "conflict"))
+	})
+	handler = middleware.RequestID(handler)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", res.Code)
+	}
+	if ct := res.Header().Get("Content-Type"); ct != ContentType {
+		t.Fatalf("expected %s, got %q", ContentType, ct)
+	}
+
+	var got Problem
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	if got.Title != "Conflict" || got.Type != "/problems/conflict" || got.Code != "conflict" || got.Instance == "" {
+		t.Fatalf("unexpected problem: %+v", got)
+	}
+}
@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+
+	"go-crud/internal/user"
+)
+
+// repository decorates a user.Repository with a span per call, leaving
+// PostgresRepository itself free of tracing. Repositories handed to
+// transaction callbacks are decorated too.
+type repository struct {
+	next user.Repository
+}
+
+// NewRepository returns next instrumented with spans.
+func NewRepository(next user.Repository) user.Repository {
+	return &repository{next: next}
+}
+
+// start opens the span for one repository method.
+func start(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "user.Repository/"+method)
+}
+
+func (r *repository) Create(ctx context.Context, input user.CreateUserRequest) (_ user.User, err error) {
+	ctx, span := start(ctx, "Create")
+	defer end(span, &err)
+	return r.next.Create(ctx, input)
+}
+
+func (r *repository) GetByID(ctx context.Context, id uuid.UUID) (_ user.User, err error) {
+	ctx, span := start(ctx, "GetByID")
+	defer end(span, &err)
+	return r.next.GetByID(ctx, id)
+}
+
+func (r *repository) List(ctx context.Context, opts user.ListOptions) (_ user.Page, err error) {
+	ctx, span := start(ctx, "List")
+	defer end(span, &err)
+	return r.next.List(ctx, opts)
+}
+
+func (r *repository) Search(ctx context.Context, query string, limit int) (_ []user.SearchResult, err error) {
+	ctx, span := start(ctx, "Search")
+	defer end(span, &err)
+	return r.next.Search(ctx, query, limit)
+}
+
+func (r *repository) Export(ctx context.Context, f user.Filter, sort []user.SortField, fn func(user.User) error) (err error) {
+	ctx, span := start(ctx, "Export")
+	defer end(span, &err)
+	return r.next.Export(ctx, f, sort, fn)
+}
+
+func (r *repository) Update(ctx context.Context, id uuid.UUID, input user.UpdateUserRequest, expectedVersion int64) (_ user.User, err error) {
+	ctx, span := start(ctx, "Update")
+	defer end(span, &err)
+	return r.next.Update(ctx, id, input, expectedVersion)
+}
+
+func (r *repository) Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) (err error) {
+	ctx, span := start(ctx, "Delete")
+	defer end(span, &err)
+	return r.next.Delete(ctx, id, expectedVersion)
+}
+
+func (r *repository) Restore(ctx context.Context, id uuid.UUID) (_ user.User, err error) {
+	ctx, span := start(ctx, "Restore")
+	defer end(span, &err)
+	return r.next.Restore(ctx, id)
+}
+
+func (r *repository) BulkCreate(ctx context.Context, inputs []user.CreateUserRequest) (_ []user.User, err error) {
+	ctx, span := start(ctx, "BulkCreate")
+	defer end(span, &err)
+	return r.next.BulkCreate(ctx, inputs)
+}
+
+func (r *repository) PurgeDeleted(ctx context.Context, before time.Time) (_ int64, err error) {
+	ctx, span := start(ctx, "PurgeDeleted")
+	defer end(span, &err)
+	return r.next.PurgeDeleted(ctx, before)
+}
+
+func (r *repository) GetByEmail(ctx context.Context, email string) (_ user.User, err error) {
+	ctx, span := start(ctx, "GetByEmail")
+	defer end(span, &err)
+	return r.next.GetByEmail(ctx, email)
+}
+
+func (r *repository) GetPasswordHash(ctx context.Context, id uuid.UUID) (_ string, err error) {
+	ctx, span := start(ctx, "GetPasswordHash")
+	defer end(span, &err)
+	return r.next.GetPasswordHash(ctx, id)
+}
+
+func (r *repository) SetPasswordHash(ctx context.Context, id uuid.UUID, hash string) (err error) {
+	ctx, span := start(ctx, "SetPasswordHash")
+	defer end(span, &err)
+	return r.next.SetPasswordHash(ctx, id, hash)
+}
+
+func (r *repository) DeleteSessions(ctx context.Context, id uuid.UUID) (_ int64, err error) {
+	ctx, span := start(ctx, "DeleteSessions")
+	defer end(span, &err)
+	return r.next.DeleteSessions(ctx, id)
+}
+
+func (r *repository) ReplaceEmailVerification(ctx context.Context, v user.EmailVerification) (err error) {
+	ctx, span := start(ctx, "ReplaceEmailVerification")
+	defer end(span, &err)
+	return r.next.ReplaceEmailVerification(ctx, v)
+}
+
+func (r *repository) ConsumeEmailVerification(ctx context.Context, tokenHash []byte) (_ user.EmailVerification, err error) {
+	ctx, span := start(ctx, "ConsumeEmailVerification")
+	defer end(span, &err)
+	return r.next.ConsumeEmailVerification(ctx, tokenHash)
+}
+
+func (r *repository) MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) (_ user.User, err error) {
+	ctx, span := start(ctx, "MarkEmailVerified")
+	defer end(span, &err)
+	return r.next.MarkEmailVerified(ctx, id, email)
+}
+
+func (r *repository) PurgeEmailVerifications(ctx context.Context) (_ int64, err error) {
+	ctx, span := start(ctx, "PurgeEmailVerifications")
+	defer end(span, &err)
+	return r.next.PurgeEmailVerifications(ctx)
+}
+
+func (r *repository) GetForUpdate(ctx context.Context, id uuid.UUID, includeDeleted bool) (_ user.User, err error) {
+	ctx, span := start(ctx, "GetForUpdate")
+	defer end(span, &err)
+	return r.next.GetForUpdate(ctx, id, includeDeleted)
+}
+
+func (r *repository) RecordAudit(ctx context.Context, rec user.AuditRecord) (err error) {
+	ctx, span := start(ctx, "RecordAudit")
+	defer end(span, &err)
+	return r.next.RecordAudit(ctx, rec)
+}
+
+func (r *repository) ListAudit(ctx context.Context, q user.AuditQuery) (_ user.AuditPage, err error) {
+	ctx, span := start(ctx, "ListAudit")
+	defer end(span, &err)
+	return r.next.ListAudit(ctx, q)
+}
+
+// WithTx and RunBatch span the whole transaction, with the calls made inside
+// it as children.
+func (r *repository) WithTx(ctx context.Context, fn func(tx user.Repository) error) (err error) {
+	ctx, span := start(ctx, "WithTx")
+	defer end(span, &err)
+	return r.next.WithTx(ctx, func(tx user.Repository) error {
+		return fn(&repository{next: tx})
+	})
+}
+
+func (r *repository) RunBatch(ctx context.Context, n int, atomic bool, fn func(tx user.Repository, i int) error) (_ []error, err error) {
+	ctx, span := start(ctx, "RunBatch")
+	defer end(span, &err)
+	return r.next.RunBatch(ctx, n, atomic, func(tx user.Repository, i int) error {
+		return fn(&repository{next: tx}, i)
+	})
+}
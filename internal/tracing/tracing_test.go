@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return rec
+}
+
+func attr(attrs []attribute.KeyValue, key string) (attribute.Value, bool) {
+	for _, kv := range attrs {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestMiddlewareContinuesTraceparentAndNamesSpanByRoute(t *testing.T) {
+	rec := recordSpans(t)
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/users/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /users/{id}" {
+		t.Fatalf("unexpected span name %q", span.Name())
+	}
+	if got := span.Parent().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected trace to continue from traceparent, got %s", got)
+	}
+	if v, _ := attr(span.Attributes(), "http.response.status_code"); v.AsInt64() != 500 || span.Status().Code != codes.Error {
+		t.Fatalf("expected failed span with status 500, got %v %v", v.AsInt64(), span.Status())
+	}
+}
+
+func TestQueryTracerAttachesSQLButNotParameters(t *testing.T) {
+	rec := recordSpans(t)
+	sql := "-- name: GetUserByID :one\nSELECT user_id FROM users WHERE user_id = $1"
+
+	ctx := QueryTracer{}.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: sql, Args: []any{"ada@example.com"}})
+	QueryTracer{}.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	span := rec.Ended()[0]
+	if span.Name() != "GetUserByID" {
+		t.Fatalf("expected span named after the sqlc query, got %q", span.Name())
+	}
+	if v, _ := attr(span.Attributes(), "db.query.text"); v.AsString() != sql {
+		t.Fatalf("expected SQL text attached, got %q", v.AsString())
+	}
+	for _, kv := range span.Attributes() {
+		if kv.Value.Emit() == "ada@example.com" {
+			t.Fatalf("parameter value leaked in attribute %s", kv.Key)
+		}
+	}
+	if span.Status().Code != codes.Error {
+		t.Fatalf("expected error status, got %v", span.Status())
+	}
+}
+
+func TestQueryName(t *testing.T) {
+	tests := map[string]string{
+		"-- name: ListUsers :many\nSELECT 1":   "ListUsers",
+		"FETCH FORWARD 1000 FROM users_export": "FETCH",
+		"  begin":                              "BEGIN",
+	}
+	for sql, want := range tests {
+		if got := queryName(sql); got != want {
+			t.Fatalf("queryName(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package user
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+)
+
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	// AuditPasswordChange records that a password was set, without
+	// recording it.
+	AuditPasswordChange = "password_change"
+	// AuditEmailVerified records that a user proved they own their email.
+	AuditEmailVerified = "email_verified"
+)
+
+// AnonymousActor is recorded when a mutation carries no actor.
+const AnonymousActor = "anonymous"
+
+// AuditRecord describes one mutation of a user: who made it, from which
+// request, and the fields it changed.
+type AuditRecord struct {
+	ID        int64                  `json:"id"`
+	UserID    uuid.UUID              `json:"userId"`
+	Action    string                 `json:"action"`
+	Actor     string                 `json:"actor"`
+	RequestID string                 `json:"requestId,omitempty"`
+	Changes   map[string]FieldChange `json:"changes"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+// FieldChange holds the value of one field before and after a mutation. A
+// nil side means the field was unset.
+type FieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditQuery selects audit records, newest first. A nil UserID spans all
+// users; Since is inclusive and Until exclusive.
+type AuditQuery struct {
+	UserID *uuid.UUID
+	Since  *time.Time
+	Until  *time.Time
+	Page   PageRequest
+}
+
+// AuditPage is one page of audit records. NextCursor is empty when there are
+// no more records.
+type AuditPage struct {
+	Records    []AuditRecord
+	NextCursor string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context attributing mutations made with it to actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or AnonymousActor.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return AnonymousActor
+}
+
+// newAuditRecord attributes a mutation to the actor and request in ctx.
+// before is nil for creations.
+func newAuditRecord(ctx context.Context, action string, before *User, after User) AuditRecord {
+	return AuditRecord{
+		UserID:    after.UserID,
+		Action:    action,
+		Actor:     ActorFromContext(ctx),
+		RequestID: middleware.GetReqID(ctx),
+		Changes:   diffUsers(before, after),
+	}
+}
+
+// diffUsers returns the audited fields whose values differ between before
+// and after, keyed by JSON field name.
+func diffUsers(before *User, after User) map[string]FieldChange {
+	var prev auditedFields
+	if before != nil {
+		prev = auditFields(*before)
+	}
+	next := auditFields(after)
+
+	changes := make(map[string]FieldChange)
+	pv, nv := reflect.ValueOf(prev), reflect.ValueOf(next)
+	for i := 0; i < pv.NumField(); i++ {
+		b, a := pv.Field(i).Interface(), nv.Field(i).Interface()
+		if reflect.DeepEqual(b, a) {
+			continue
+		}
+		name := pv.Type().Field(i).Tag.Get("json")
+		changes[name] = FieldChange{Before: b, After: a}
+	}
+	return changes
+}
+
+// auditedFields are the user fields tracked by the audit log. Nil pointers
+// mark unset values.
+type auditedFields struct {
+	FirstName       *string    `json:"firstName"`
+	LastName        *string    `json:"lastName"`
+	Email           *string    `json:"email"`
+	Phone           *string    `json:"phone"`
+	Age             *int       `json:"age"`
+	Status          *string    `json:"status"`
+	DeletedAt       *time.Time `json:"deletedAt"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+}
+
+func auditFields(u User) auditedFields {
+	return auditedFields{
+		FirstName:       nonEmpty(u.FirstName),
+		LastName:        nonEmpty(u.LastName),
+		Email:           nonEmpty(u.Email),
+		Phone:           nonEmpty(u.Phone),
+		Age:             u.Age,
+		Status:          nonEmpty(u.Status),
+		DeletedAt:       u.DeletedAt,
+		EmailVerifiedAt: u.EmailVerifiedAt,
+	}
+}
+
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// auditCursor is the position of the last record of an audit page, ordered
+// by (created_at DESC, audit_id DESC).
+type auditCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        int64     `json:"id"`
+}
+
+func encodeAuditCursor(c auditCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeAuditCursor(s string) (auditCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return auditCursor{}, ErrInvalidCursor
+	}
+	var c auditCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == 0 || c.CreatedAt.IsZero() {
+		return auditCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
@@ -0,0 +1,70 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDiffUsersOnCreateListsSetFields(t *testing.T) {
+	age := 30
+	changes := diffUsers(nil, User{FirstName: "John", LastName: "Doe", Email: "john@example.com", Age: &age, Status: StatusActive})
+
+	for _, field := range []string{"firstName", "lastName", "email", "age", "status"} {
+		c, ok := changes[field]
+		if !ok {
+			t.Fatalf("expected %s in changes, got %+v", field, changes)
+		}
+		if !isNil(c.Before) {
+			t.Fatalf("expected nil before for %s, got %v", field, c.Before)
+		}
+	}
+	if _, ok := changes["phone"]; ok {
+		t.Fatal("unset phone should not be recorded")
+	}
+}
+
+func TestDiffUsersOnDeleteRecordsDeletedAt(t *testing.T) {
+	now := time.Now()
+	before := User{FirstName: "John", Email: "john@example.com"}
+	after := before
+	after.DeletedAt = &now
+
+	changes := diffUsers(&before, after)
+	if len(changes) != 1 || changes["deletedAt"].After.(*time.Time) != &now {
+		t.Fatalf("expected only deletedAt to change, got %+v", changes)
+	}
+}
+
+func TestActorFromContextDefaultsToAnonymous(t *testing.T) {
+	if got := ActorFromContext(context.Background()); got != AnonymousActor {
+		t.Fatalf("expected %q, got %q", AnonymousActor, got)
+	}
+	if got := ActorFromContext(WithActor(context.Background(), "ops")); got != "ops" {
+		t.Fatalf("expected ops, got %q", got)
+	}
+}
+
+func TestAuditCursorRoundTrip(t *testing.T) {
+	want := auditCursor{CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC), ID: 42}
+	got, err := decodeAuditCursor(encodeAuditCursor(want))
+	if err != nil || !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Fatalf("round trip failed: %+v, %v", got, err)
+	}
+	if _, err := decodeAuditCursor("e30"); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func isNil(v any) bool {
+	switch p := v.(type) {
+	case *string:
+		return p == nil
+	case *int:
+		return p == nil
+	case *time.Time:
+		return p == nil
+	}
+	return v == nil
+}
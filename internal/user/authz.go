@@ -0,0 +1,159 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"go-crud/internal/auth"
+)
+
+// Actions checked by an Authorizer, one per Service operation.
+const (
+	ActionCreate  = "users.create"
+	ActionRead    = "users.read"
+	ActionList    = "users.list"
+	ActionSearch  = "users.search"
+	ActionExport  = "users.export"
+	ActionImport  = "users.import"
+	ActionUpdate  = "users.update"
+	ActionDelete  = "users.delete"
+	ActionRestore = "users.restore"
+	ActionAudit   = "users.audit"
+	// ActionSetPassword sets a user's password.
+	ActionSetPassword = "users.password"
+)
+
+// Actions lists every action an Authorizer may be asked about.
+var Actions = []string{
+	ActionCreate, ActionRead, ActionList, ActionSearch, ActionExport, ActionImport,
+	ActionUpdate, ActionDelete, ActionRestore, ActionAudit, ActionSetPassword,
+}
+
+var ErrForbidden = errors.New("forbidden")
+
+// ForbiddenError reports an operation denied by an authorization rule. It
+// matches ErrForbidden with errors.Is.
+type ForbiddenError struct {
+	Action string
+	Rule   string
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("%s denied by rule %q", e.Action, e.Rule)
+}
+
+func (e *ForbiddenError) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+// Operation describes what a caller is about to do.
+type Operation struct {
+	Action string
+	// UserID is the user acted on, for actions on a single user.
+	UserID *uuid.UUID
+	// Fields lists the JSON names of the fields a create or update sets.
+	Fields []string
+	// Status is the status a create or update sets, if any.
+	Status string
+	// IncludeDeleted reports whether a list or export includes soft-deleted
+	// users.
+	IncludeDeleted bool
+}
+
+// Authorizer decides whether a principal may perform an operation,
+// returning a *ForbiddenError if not.
+type Authorizer interface {
+	Authorize(ctx context.Context, p auth.Principal, op Operation) error
+}
+
+type ServiceOption func(*Service)
+
+// WithAuthorizer consults a before every operation made on behalf of an
+// authenticated principal, in place of SessionAuthorizer. Calls without a
+// principal, such as those from the command line and the purger, are
+// trusted.
+func WithAuthorizer(a Authorizer) ServiceOption {
+	return func(s *Service) {
+		s.authorizer = a
+	}
+}
+
+// SessionRule names the rule SessionAuthorizer denies operations by.
+const SessionRule = "sessions-own-record"
+
+// SessionAuthorizer is the Authorizer of services without WithAuthorizer.
+// It confines password sessions to reading, updating and setting the
+// password of their own record, without changing its status, and leaves
+// other principals to their scopes.
+type SessionAuthorizer struct{}
+
+func (SessionAuthorizer) Authorize(_ context.Context, p auth.Principal, op Operation) error {
+	if !slices.Contains(p.Roles, auth.SessionRole) {
+		return nil
+	}
+	self := op.UserID != nil && p.UserID != "" && strings.EqualFold(op.UserID.String(), p.UserID)
+	switch {
+	case !self:
+	case op.Action == ActionRead, op.Action == ActionSetPassword:
+		return nil
+	case op.Action == ActionUpdate && !slices.Contains(op.Fields, "status"):
+		return nil
+	}
+	return &ForbiddenError{Action: op.Action, Rule: SessionRule}
+}
+
+func (s *Service) authorize(ctx context.Context, op Operation) error {
+	if s.authorizer == nil {
+		return nil
+	}
+	p, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return s.authorizer.Authorize(ctx, p, op)
+}
+
+func createOperation(input CreateUserRequest) Operation {
+	op := Operation{Action: ActionCreate, Status: input.Status, Fields: []string{"firstName", "lastName", "email"}}
+	if input.Phone != "" {
+		op.Fields = append(op.Fields, "phone")
+	}
+	if input.Age != nil {
+		op.Fields = append(op.Fields, "age")
+	}
+	if input.Status != "" {
+		op.Fields = append(op.Fields, "status")
+	}
+	if input.Password != "" {
+		op.Fields = append(op.Fields, "password")
+	}
+	return op
+}
+
+func updateOperation(id uuid.UUID, input UpdateUserRequest) Operation {
+	op := Operation{Action: ActionUpdate, UserID: &id}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"firstName", input.FirstName != nil},
+		{"lastName", input.LastName != nil},
+		{"email", input.Email != nil},
+		{"phone", input.Phone != nil},
+		{"age", input.Age != nil},
+		{"status", input.Status != nil},
+	} {
+		if f.set {
+			op.Fields = append(op.Fields, f.name)
+		}
+	}
+	if input.Status != nil {
+		op.Status = *input.Status
+	}
+	return op
+}
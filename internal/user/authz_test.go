@@ -0,0 +1,174 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"go-crud/internal/auth"
+	"go-crud/internal/problem"
+)
+
+type authorizerFunc func(context.Context, auth.Principal, Operation) error
+
+func (f authorizerFunc) Authorize(ctx context.Context, p auth.Principal, op Operation) error {
+	return f(ctx, p, op)
+}
+
+func denyAll(rule string) Authorizer {
+	return authorizerFunc(func(_ context.Context, _ auth.Principal, op Operation) error {
+		return &ForbiddenError{Action: op.Action, Rule: rule}
+	})
+}
+
+func TestServiceAuthorizesUpdateBeforeWriting(t *testing.T) {
+	id := uuid.New()
+	status := StatusInactive
+	email := "jane@example.com"
+	var got []Operation
+	svc := NewService(stubRepo{
+		updateFn: func(context.Context, uuid.UUID, UpdateUserRequest, int64) (User, error) {
+			t.Fatal("repository should not be called for a denied update")
+			return User{}, nil
+		},
+	}, WithAuthorizer(authorizerFunc(func(_ context.Context, p auth.Principal, op Operation) error {
+		if p.Subject != "jwt:jane" {
+			t.Fatalf("unexpected principal %+v", p)
+		}
+		got = append(got, op)
+		return &ForbiddenError{Action: op.Action, Rule: "only-admins-deactivate"}
+	})))
+
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "jwt:jane"})
+	_, err := svc.Update(ctx, id, UpdateUserRequest{Email: &email, Status: &status}, 0)
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+	if len(got) != 1 || got[0].Action != ActionUpdate || *got[0].UserID != id || got[0].Status != StatusInactive {
+		t.Fatalf("unexpected operations: %+v", got)
+	}
+	if !slices.Equal(got[0].Fields, []string{"email", "status"}) {
+		t.Fatalf("unexpected fields: %v", got[0].Fields)
+	}
+}
+
+func TestServiceAuthorizesListingDeletedUsers(t *testing.T) {
+	var ops []Operation
+	svc := NewService(stubRepo{}, WithAuthorizer(authorizerFunc(func(_ context.Context, _ auth.Principal, op Operation) error {
+		ops = append(ops, op)
+		return nil
+	})))
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "jwt:root"})
+
+	if _, err := svc.List(ctx, ListOptions{Filter: Filter{IncludeDeleted: true}}); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if err := svc.Export(ctx, io.Discard, ExportOptions{Filter: Filter{IncludeDeleted: true}, Format: ExportNDJSON}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(ops) != 2 || !ops[0].IncludeDeleted || !ops[1].IncludeDeleted {
+		t.Fatalf("expected both operations to include deleted users, got %+v", ops)
+	}
+}
+
+func TestServiceTrustsCallsWithoutPrincipal(t *testing.T) {
+	svc := NewService(stubRepo{}, WithAuthorizer(denyAll("never")))
+	if _, err := svc.GetByID(context.Background(), uuid.New()); err != nil {
+		t.Fatalf("expected internal call to be allowed, got %v", err)
+	}
+}
+
+func TestSessionAuthorizerConfinesSessionsToOwnRecord(t *testing.T) {
+	own, other := uuid.New(), uuid.New()
+	session := auth.SessionPrincipal(own, "ada@example.com")
+	tests := []struct {
+		name  string
+		p     auth.Principal
+		op    Operation
+		allow bool
+	}{
+		{"read own", session, Operation{Action: ActionRead, UserID: &own}, true},
+		{"update own", session, Operation{Action: ActionUpdate, UserID: &own, Fields: []string{"phone"}}, true},
+		{"own password", session, Operation{Action: ActionSetPassword, UserID: &own}, true},
+		{"own status", session, Operation{Action: ActionUpdate, UserID: &own, Fields: []string{"status"}, Status: StatusInactive}, false},
+		{"delete own", session, Operation{Action: ActionDelete, UserID: &own}, false},
+		{"update other", session, Operation{Action: ActionUpdate, UserID: &other, Fields: []string{"phone"}}, false},
+		{"delete other", session, Operation{Action: ActionDelete, UserID: &other}, false},
+		{"list", session, Operation{Action: ActionList}, false},
+		{"import", session, Operation{Action: ActionImport}, false},
+		{"api key", auth.Principal{Subject: "apikey:x", Scopes: []string{auth.ScopeUsersWrite}}, Operation{Action: ActionDelete, UserID: &other}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SessionAuthorizer{}.Authorize(context.Background(), tt.p, tt.op)
+			if tt.allow && err != nil {
+				t.Fatalf("expected allowed, got %v", err)
+			}
+			var denied *ForbiddenError
+			if !tt.allow && (!errors.As(err, &denied) || denied.Rule != SessionRule) {
+				t.Fatalf("expected %s denial, got %v", SessionRule, err)
+			}
+		})
+	}
+}
+
+func TestServiceConfinesSessionsWithoutAuthorizer(t *testing.T) {
+	svc := NewService(stubRepo{})
+	ctx := auth.WithPrincipal(context.Background(), auth.SessionPrincipal(uuid.New(), "ada@example.com"))
+	if err := svc.Delete(ctx, uuid.New(), 0); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected another user's session to be denied, got %v", err)
+	}
+}
+
+func TestServiceBatchReportsDeniedItems(t *testing.T) {
+	svc := NewService(stubRepo{}, WithAuthorizer(authorizerFunc(func(_ context.Context, _ auth.Principal, op Operation) error {
+		if op.Action == ActionDelete {
+			return &ForbiddenError{Action: op.Action, Rule: "support-cannot-delete"}
+		}
+		return nil
+	})))
+
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "jwt:help"})
+	results, err := svc.Batch(ctx, []BatchOperation{
+		{Op: BatchCreate, Create: CreateUserRequest{FirstName: "John", LastName: "Doe", Email: "john@example.com"}},
+		{Op: BatchDelete, ID: uuid.New()},
+	}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Err != nil || !errors.Is(results[1].Err, ErrForbidden) {
+		t.Fatalf("expected only the delete to be denied, got %+v", results)
+	}
+}
+
+func TestPatchReportsDeniedRule(t *testing.T) {
+	h := NewHandler(NewService(stubRepo{}, WithAuthorizer(denyAll("users-keep-own-status"))))
+	r := chi.NewRouter()
+	h.RegisterRoutes(r)
+
+	body, _ := json.Marshal(map[string]any{"status": StatusActive})
+	req := httptest.NewRequest(http.MethodPatch, "/users/"+uuid.NewString(), bytes.NewReader(body))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Subject: "jwt:ada"}))
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", res.Code, res.Body)
+	}
+
+	var got problem.Problem
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Code != "policy_denied" || got.Rule != "users-keep-own-status" {
+		t.Fatalf("unexpected problem: %+v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MaxBatchSize bounds the number of operations in one batch.
+const MaxBatchSize = 1000
+
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+var (
+	ErrUnknownBatchOp  = errors.New("unknown batch operation")
+	ErrBatchRolledBack = errors.New("rolled back because another operation in the batch failed")
+)
+
+// BatchOperation is one item of a batch. Create is used by create operations,
+// Update by update operations; ID and Version by updates and deletes, where a
+// zero Version skips the version check.
+type BatchOperation struct {
+	Op      string
+	ID      uuid.UUID
+	Version int64
+	Create  CreateUserRequest
+	Update  UpdateUserRequest
+}
+
+// BatchResult is the outcome of one operation. User is set when a create or
+// update succeeded.
+type BatchResult struct {
+	User *User
+	Err  error
+}
+
+// Batch applies ops in order and reports the outcome of each. In atomic mode
+// either every operation is applied or none is; operations that succeeded in
+// a failed atomic batch report ErrBatchRolledBack. Otherwise each operation
+// is applied or rejected on its own.
+func (s *Service) Batch(ctx context.Context, ops []BatchOperation, atomic bool) (_ []BatchResult, err error) {
+	ctx, end := startSpan(ctx, "Batch", attribute.Int("batch.size", len(ops)), attribute.Bool("batch.atomic", atomic))
+	defer end(&err)
+
+	results := make([]BatchResult, len(ops))
+	mails := make([]outbox, len(ops))
+	errs, err := s.repo.RunBatch(ctx, len(ops), atomic, func(tx Repository, i int) error {
+		u, err := s.apply(ctx, tx, ops[i], &mails[i])
+		if err != nil {
+			return err
+		}
+		results[i].User = u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	failed := slices.ContainsFunc(errs, func(err error) bool { return err != nil })
+	if !atomic || !failed {
+		for i, err := range errs {
+			if err == nil {
+				s.send(ctx, mails[i])
+			}
+		}
+	}
+	for i, err := range errs {
+		switch {
+		case err != nil:
+			results[i] = BatchResult{Err: err}
+		case atomic && failed:
+			results[i] = BatchResult{Err: ErrBatchRolledBack}
+		}
+	}
+	return results, nil
+}
+
+func (s *Service) apply(ctx context.Context, tx Repository, op BatchOperation, out *outbox) (*User, error) {
+	switch op.Op {
+	case BatchCreate:
+		u, err := s.create(ctx, tx, op.Create, out)
+		if err != nil {
+			return nil, err
+		}
+		return &u, nil
+	case BatchUpdate:
+		u, err := s.update(ctx, tx, op.ID, op.Update, op.Version, out)
+		if err != nil {
+			return nil, err
+		}
+		return &u, nil
+	case BatchDelete:
+		return nil, s.delete(ctx, tx, op.ID, op.Version)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownBatchOp, op.Op)
+	}
+}
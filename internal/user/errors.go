@@ -0,0 +1,52 @@
+package user
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres SQLSTATE codes translated into domain errors.
+const (
+	pgUniqueViolation = "23505"
+	pgCheckViolation  = "23514"
+)
+
+var (
+	ErrEmailTaken          = errors.New("email is already in use")
+	ErrConstraintViolation = errors.New("constraint violation")
+)
+
+// ConstraintError reports a row rejected by a check constraint. It matches
+// ErrConstraintViolation with errors.Is.
+type ConstraintError struct {
+	Constraint string
+}
+
+func (e *ConstraintError) Error() string {
+	return "value violates constraint " + e.Constraint
+}
+
+func (e *ConstraintError) Is(target error) bool {
+	return target == ErrConstraintViolation
+}
+
+// translateError maps Postgres integrity violations to domain errors and
+// returns any other error unchanged.
+func translateError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		if strings.Contains(pgErr.ConstraintName, "email") {
+			return ErrEmailTaken
+		}
+	case pgCheckViolation:
+		return &ConstraintError{Constraint: pgErr.ConstraintName}
+	}
+	return err
+}
@@ -0,0 +1,28 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestTranslateError(t *testing.T) {
+	emailDup := fmt.Errorf("insert: %w", &pgconn.PgError{Code: pgUniqueViolation, ConstraintName: "users_email_key"})
+	if err := translateError(emailDup); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("expected ErrEmailTaken, got %v", err)
+	}
+
+	check := &pgconn.PgError{Code: pgCheckViolation, ConstraintName: "users_age_check"}
+	err := translateError(check)
+	var ce *ConstraintError
+	if !errors.Is(err, ErrConstraintViolation) || !errors.As(err, &ce) || ce.Constraint != "users_age_check" {
+		t.Fatalf("expected ConstraintError for users_age_check, got %v", err)
+	}
+
+	other := errors.New("connection reset")
+	if err := translateError(other); err != other {
+		t.Fatalf("expected unrelated error to pass through, got %v", err)
+	}
+}
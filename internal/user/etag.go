@@ -0,0 +1,52 @@
+package user
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errInvalidIfMatch = errors.New("If-Match must be * or a single strong entity tag")
+
+// etag is the strong entity tag of a user representation, derived from its
+// version.
+func etag(u User) string {
+	return `"` + strconv.FormatInt(u.Version, 10) + `"`
+}
+
+// parseIfMatch returns the version required by an If-Match header value.
+// "*" only requires that the user exists and is reported as version 0.
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0, nil
+	}
+	if strings.Contains(header, ",") {
+		return 0, errInvalidIfMatch
+	}
+	if strings.HasPrefix(header, "W/") {
+		// Weak tags never match under the strong comparison If-Match uses.
+		return 0, ErrVersionMismatch
+	}
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, errInvalidIfMatch
+	}
+	v, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || v < 1 {
+		// An unparseable tag can never match; report it as a stale version.
+		return 0, ErrVersionMismatch
+	}
+	return v, nil
+}
+
+// noneMatch reports whether an If-None-Match header value matches tag using
+// the weak comparison function.
+func noneMatch(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
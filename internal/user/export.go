@@ -0,0 +1,195 @@
+package user
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+)
+
+var ErrInvalidExport = errors.New("invalid export")
+
+// ExportColumns lists the exportable fields, named as in the JSON
+// representation of User, in their default order.
+var ExportColumns = []string{
+	"userId", "firstName", "lastName", "email", "phone", "age",
+	"status", "createdAt", "updatedAt", "version", "deletedAt", "emailVerifiedAt",
+}
+
+// ExportOptions selects and orders the users to export and how to render
+// them. Header applies to CSV only.
+type ExportOptions struct {
+	Filter  Filter
+	Sort    []SortField
+	Format  string
+	Columns []string
+	Header  bool
+}
+
+// ParseExportColumns parses a comma-separated list of ExportColumns. An empty
+// list selects every column.
+func ParseExportColumns(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return ExportColumns, nil
+	}
+
+	seen := make(map[string]bool)
+	var columns []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if !slices.Contains(ExportColumns, c) {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidExport, c)
+		}
+		if seen[c] {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidExport, c)
+		}
+		seen[c] = true
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// exportWriter renders users one at a time. Close flushes buffered output.
+type exportWriter interface {
+	Write(u User) error
+	Close() error
+}
+
+func newExportWriter(w io.Writer, opts ExportOptions) (exportWriter, error) {
+	switch opts.Format {
+	case ExportCSV:
+		cw := &csvExportWriter{w: csv.NewWriter(w), columns: opts.Columns}
+		if opts.Header {
+			if err := cw.w.Write(opts.Columns); err != nil {
+				return nil, err
+			}
+		}
+		return cw, nil
+	case ExportNDJSON:
+		return &ndjsonExportWriter{w: bufio.NewWriter(w), columns: opts.Columns}, nil
+	default:
+		return nil, fmt.Errorf("%w: format must be %s or %s", ErrInvalidExport, ExportCSV, ExportNDJSON)
+	}
+}
+
+type csvExportWriter struct {
+	w       *csv.Writer
+	columns []string
+	record  []string
+}
+
+func (cw *csvExportWriter) Write(u User) error {
+	cw.record = cw.record[:0]
+	for _, c := range cw.columns {
+		cw.record = append(cw.record, csvValue(exportValue(u, c)))
+	}
+	return cw.w.Write(cw.record)
+}
+
+func (cw *csvExportWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// csvValue renders v as a CSV field; unset values become empty fields.
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type ndjsonExportWriter struct {
+	w       *bufio.Writer
+	columns []string
+}
+
+// Write emits one JSON object per line, with keys in column order.
+func (nw *ndjsonExportWriter) Write(u User) error {
+	nw.w.WriteByte('{')
+	for i, c := range nw.columns {
+		if i > 0 {
+			nw.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(c)
+		value, err := json.Marshal(exportValue(u, c))
+		if err != nil {
+			return err
+		}
+		nw.w.Write(key)
+		nw.w.WriteByte(':')
+		nw.w.Write(value)
+	}
+	nw.w.WriteString("}\n")
+	// bufio.Writer keeps the first write error and returns it from Flush.
+	return nil
+}
+
+func (nw *ndjsonExportWriter) Close() error {
+	return nw.w.Flush()
+}
+
+// exportValue returns the value of column for u. Unset optional fields are
+// nil so that they render as empty CSV fields and JSON nulls.
+func exportValue(u User, column string) any {
+	switch column {
+	case "userId":
+		return u.UserID.String()
+	case "firstName":
+		return u.FirstName
+	case "lastName":
+		return u.LastName
+	case "email":
+		return u.Email
+	case "phone":
+		if u.Phone == "" {
+			return nil
+		}
+		return u.Phone
+	case "age":
+		if u.Age == nil {
+			return nil
+		}
+		return *u.Age
+	case "status":
+		return u.Status
+	case "createdAt":
+		return u.CreatedAt
+	case "updatedAt":
+		return u.UpdatedAt
+	case "version":
+		return u.Version
+	case "deletedAt":
+		if u.DeletedAt == nil {
+			return nil
+		}
+		return *u.DeletedAt
+	case "emailVerifiedAt":
+		if u.EmailVerifiedAt == nil {
+			return nil
+		}
+		return *u.EmailVerifiedAt
+	}
+	return nil
+}
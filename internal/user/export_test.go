@@ -0,0 +1,82 @@
+package user
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseExportColumns(t *testing.T) {
+	columns, err := ParseExportColumns("email, firstName")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(columns, ",") != "email,firstName" {
+		t.Fatalf("expected columns in request order, got %v", columns)
+	}
+
+	all, err := ParseExportColumns("")
+	if err != nil || len(all) != len(ExportColumns) {
+		t.Fatalf("expected every column by default, got %v, %v", all, err)
+	}
+
+	for _, in := range []string{"password", "email,email", "email,"} {
+		if _, err := ParseExportColumns(in); err == nil {
+			t.Fatalf("expected error for %q", in)
+		}
+	}
+}
+
+func TestExportWriters(t *testing.T) {
+	age := 36
+	users := []User{
+		{UserID: uuid.MustParse("550e8400-e29b-41d4-a716-446655440000"), FirstName: "Ada", LastName: "Lovelace, Countess", Age: &age},
+		{UserID: uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"), FirstName: "Alan", CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+
+	tests := []struct {
+		name string
+		opts ExportOptions
+		want string
+	}{
+		{
+			name: "csv with header",
+			opts: ExportOptions{Format: ExportCSV, Columns: []string{"firstName", "lastName", "age"}, Header: true},
+			want: "firstName,lastName,age\nAda,\"Lovelace, Countess\",36\nAlan,,\n",
+		},
+		{
+			name: "csv without header",
+			opts: ExportOptions{Format: ExportCSV, Columns: []string{"userId", "createdAt"}},
+			want: "550e8400-e29b-41d4-a716-446655440000,0001-01-01T00:00:00Z\n6ba7b810-9dad-11d1-80b4-00c04fd430c8,2024-01-02T03:04:05Z\n",
+		},
+		{
+			name: "ndjson keeps column order and nulls",
+			opts: ExportOptions{Format: ExportNDJSON, Columns: []string{"lastName", "age", "firstName"}},
+			want: `{"lastName":"Lovelace, Countess","age":36,"firstName":"Ada"}` + "\n" + `{"lastName":"","age":null,"firstName":"Alan"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := newExportWriter(&buf, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, u := range users {
+				if err := w.Write(u); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Fatalf("unexpected output:\n%s\nwant:\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
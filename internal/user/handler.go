@@ -1,118 +1,879 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go-crud/internal/auth"
+	"go-crud/internal/logging"
+	"go-crud/internal/problem"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 )
 
 type Handler struct {
-	svc *Service
+	svc            *Service
+	requireIfMatch bool
+	idempotency    IdempotencyStore
+	idempotencyTTL time.Duration
 }
 
-func NewHandler(svc *Service) *Handler {
-	return &Handler{svc: svc}
+// Problem types for errors specific to user resources.
+const (
+	problemTypeEmailTaken   = "/problems/email-taken"
+	problemTypeConstraint   = "/problems/constraint-violation"
+	problemTypeIdempotency  = "/problems/idempotency-key"
+	problemTypeForbidden    = "/problems/forbidden"
+	problemTypeWeakPassword = "/problems/weak-password"
+	problemTypeVerification = "/problems/invalid-verification-token"
+)
+
+type HandlerOption func(*Handler)
+
+// WithRequireIfMatch makes PATCH and DELETE answer 428 Precondition Required
+// when the request carries no If-Match header.
+func WithRequireIfMatch(required bool) HandlerOption {
+	return func(h *Handler) {
+		h.requireIfMatch = required
+	}
+}
+
+// WithIdempotency makes POST /users honour the Idempotency-Key header,
+// keeping responses in store for ttl.
+func WithIdempotency(store IdempotencyStore, ttl time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.idempotency = store
+		h.idempotencyTTL = ttl
+	}
+}
+
+func NewHandler(svc *Service, opts ...HandlerOption) *Handler {
+	h := &Handler{svc: svc}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *Handler) RegisterRoutes(r chi.Router) {
 	r.Post("/users", h.Create)
+	r.Post("/users:batch", h.Batch)
 	r.Get("/users/{id}", h.GetByID)
 	r.Get("/users", h.List)
+	r.Get("/users/search", h.Search)
+	r.Get("/users/export", h.Export)
+	r.Post("/users/import", h.Import)
 	r.Patch("/users/{id}", h.Update)
 	r.Delete("/users/{id}", h.Delete)
+	r.Post("/users/{id}/restore", h.Restore)
+	r.Post("/users/{id}/password", h.SetPassword)
+	r.Get("/users/{id}/audit", h.UserAudit)
+	r.Get("/audit", h.Audit)
+}
+
+// RegisterPublicRoutes registers the routes that must stay open, since their
+// callers prove who they are some other way: POST /users/verify-email with
+// the token emailed to them.
+func (h *Handler) RegisterPublicRoutes(r chi.Router) {
+	r.Post("/users/verify-email", h.VerifyEmail)
 }
 
 func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	if key := r.Header.Get("Idempotency-Key"); key != "" && h.idempotency != nil {
+		h.idempotent(w, r, key, h.create)
+		return
+	}
+	h.create(w, r)
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
 	var req CreateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON payload"})
+		writeProblem(w, r, http.StatusBadRequest, "invalid JSON payload")
 		return
 	}
 
 	u, err := h.svc.Create(r.Context(), req)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		handleRepoError(w, r, err)
 		return
 	}
+	logging.SetUserID(r.Context(), u.UserID.String())
+	w.Header().Set("ETag", etag(u))
 	writeJSON(w, http.StatusCreated, u)
 }
 
 func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id, err := parseID(r)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+		writeProblem(w, r, http.StatusBadRequest, "invalid user id")
 		return
 	}
 
 	u, err := h.svc.GetByID(r.Context(), id)
 	if err != nil {
-		handleRepoError(w, err)
+		handleRepoError(w, r, err)
+		return
+	}
+
+	tag := etag(u)
+	w.Header().Set("ETag", tag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && noneMatch(inm, tag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 	writeJSON(w, http.StatusOK, u)
 }
 
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
-	users, err := h.svc.List(r.Context())
+	opts, err := parseListOptions(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.svc.List(r.Context(), opts)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list users"})
+		if errors.Is(err, ErrInvalidCursor) {
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			handleRepoError(w, r, err)
+			return
+		}
+		internalError(w, r, err, "failed to list users")
 		return
 	}
-	writeJSON(w, http.StatusOK, users)
+	writeJSON(w, http.StatusOK, listResponse{Items: result.Users, NextCursor: result.NextCursor})
+}
+
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxSearchLimit {
+			writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be an integer between 1 and %d", MaxSearchLimit))
+			return
+		}
+		limit = n
+	}
+
+	results, err := h.svc.Search(r.Context(), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		if errors.Is(err, ErrEmptySearchQuery) {
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, ErrForbidden) {
+			handleRepoError(w, r, err)
+			return
+		}
+		internalError(w, r, err, "failed to search users")
+		return
+	}
+	writeJSON(w, http.StatusOK, searchResponse{Items: results})
+}
+
+// Export streams every matching user as CSV or NDJSON. Errors found before
+// any output are reported as problems; later ones abort the connection so
+// that clients cannot mistake a truncated export for a complete one.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseExportOptions(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Exports may take longer than the server's write timeout allows for
+	// ordinary responses.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	resp := &exportResponse{w: w, contentType: exportContentTypes[opts.Format], filename: "users." + opts.Format}
+	if err := h.svc.Export(r.Context(), resp, opts); err != nil {
+		if resp.started {
+			slog.ErrorContext(r.Context(), "export aborted", "error", err)
+			panic(http.ErrAbortHandler)
+		}
+		if errors.Is(err, ErrForbidden) {
+			handleRepoError(w, r, err)
+			return
+		}
+		internalError(w, r, err, "failed to export users")
+		return
+	}
+	if !resp.started {
+		resp.start()
+	}
+}
+
+// Import creates users from a CSV or NDJSON upload, chosen by Content-Type,
+// and reports the outcome of every row. dryRun=true reports the same outcomes
+// without creating anyone.
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	format, ok := importFormats[mediaType]
+	if !ok {
+		writeProblem(w, r, http.StatusUnsupportedMediaType, "Content-Type must be text/csv or application/x-ndjson")
+		return
+	}
+
+	dryRun := false
+	for key, values := range r.URL.Query() {
+		if key != "dryRun" {
+			writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("unknown query parameter %q", key))
+			return
+		}
+		var err error
+		if dryRun, err = strconv.ParseBool(values[0]); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "dryRun must be true or false")
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	report, err := h.svc.Import(r.Context(), format, body, dryRun)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds %d bytes", maxImportBytes))
+		case errors.Is(err, ErrInvalidImport):
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+		default:
+			handleRepoError(w, r, err)
+		}
+		return
+	}
+
+	resp := importResponse{DryRun: report.DryRun, Rows: make([]importRowResponse, len(report.Rows))}
+	for i, row := range report.Rows {
+		item := importRowResponse{Row: row.Row, Status: row.Status, User: row.User, Reason: row.Reason}
+		switch row.Status {
+		case ImportCreated:
+			resp.Created++
+		case ImportSkipped:
+			resp.Skipped++
+		case ImportRejected:
+			resp.Rejected++
+			var validationErrs validator.ValidationErrors
+			if errors.As(row.Err, &validationErrs) {
+				item.Reason = "validation failed"
+				item.Errors = problem.Validation(validationErrs).Errors
+			} else {
+				item.Reason = row.Err.Error()
+			}
+		}
+		resp.Rows[i] = item
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 	id, err := parseID(r)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+		writeProblem(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	version, ok := h.expectedVersion(w, r)
+	if !ok {
 		return
 	}
 
 	var req UpdateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON payload"})
+		writeProblem(w, r, http.StatusBadRequest, "invalid JSON payload")
 		return
 	}
 
-	u, err := h.svc.Update(r.Context(), id, req)
+	u, err := h.svc.Update(r.Context(), id, req, version)
 	if err != nil {
-		if errors.Is(err, ErrNotFound) {
-			writeJSON(w, http.StatusNotFound, map[string]string{"error": ErrNotFound.Error()})
-			return
-		}
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		handleRepoError(w, r, err)
 		return
 	}
+	w.Header().Set("ETag", etag(u))
 	writeJSON(w, http.StatusOK, u)
 }
 
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	id, err := parseID(r)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+		writeProblem(w, r, http.StatusBadRequest, "invalid user id")
 		return
 	}
 
-	if err := h.svc.Delete(r.Context(), id); err != nil {
-		handleRepoError(w, err)
+	version, ok := h.expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.svc.Delete(r.Context(), id, version); err != nil {
+		handleRepoError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// Batch applies a list of create, update and delete operations. The response
+// is 200 whenever the batch was processed and reports each operation's
+// outcome; in atomic mode a single failure rolls back every operation.
+func (h *Handler) Batch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	var atomic bool
+	switch req.Mode {
+	case "", batchModeAtomic:
+		atomic = true
+	case batchModeBestEffort:
+	default:
+		writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("mode must be %q or %q", batchModeAtomic, batchModeBestEffort))
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > MaxBatchSize {
+		writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("operations must contain between 1 and %d items", MaxBatchSize))
+		return
+	}
+
+	ops, fieldErrs := h.parseBatchOperations(req.Operations)
+	if len(fieldErrs) > 0 {
+		p := problem.New(http.StatusBadRequest, "request validation failed")
+		p.Type = problem.TypeValidation
+		p.Errors = fieldErrs
+		problem.Write(w, r, p)
+		return
+	}
+
+	results, err := h.svc.Batch(r.Context(), ops, atomic)
+	if err != nil {
+		handleRepoError(w, r, err)
+		return
+	}
+
+	resp := batchResponse{Results: make([]batchItemResponse, len(results))}
+	for i, res := range results {
+		item := batchItemResponse{Index: i, Op: ops[i].Op, User: res.User}
+		if res.Err != nil {
+			item.Error = problemFor(res.Err)
+			logError(r.Context(), item.Error.Status, res.Err, slog.Int("index", i))
+			item.Status = item.Error.Status
+			resp.Failed++
+		} else {
+			item.Status = batchSuccessStatus[ops[i].Op]
+			resp.Succeeded++
+		}
+		resp.Results[i] = item
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseBatchOperations checks the shape of each operation and decodes its
+// data into the request type for its op. Field rules are left to the service
+// so that they are reported per item.
+func (h *Handler) parseBatchOperations(items []batchOperationPayload) ([]BatchOperation, []problem.FieldError) {
+	ops := make([]BatchOperation, len(items))
+	var errs []problem.FieldError
+	for i, item := range items {
+		prefix := fmt.Sprintf("operations[%d].", i)
+		invalid := func(field, rule, message string) {
+			errs = append(errs, problem.FieldError{Field: prefix + field, Rule: rule, Message: prefix + message})
+		}
+
+		op := BatchOperation{Op: item.Op, Version: item.Version}
+		if item.Op == BatchUpdate || item.Op == BatchDelete {
+			if item.ID == nil {
+				invalid("id", "required", "id is required")
+			} else {
+				op.ID = *item.ID
+			}
+			if h.requireIfMatch && item.Version == 0 {
+				invalid("version", "required", "version is required")
+			}
+		}
+
+		var target any
+		switch item.Op {
+		case BatchCreate:
+			target = &op.Create
+		case BatchUpdate:
+			target = &op.Update
+		case BatchDelete:
+		default:
+			invalid("op", "oneof", "op must be one of: create update delete")
+		}
+		if target != nil {
+			if len(item.Data) == 0 {
+				invalid("data", "required", "data is required")
+			} else if err := json.Unmarshal(item.Data, target); err != nil {
+				invalid("data", "json", "data must be a valid "+item.Op+" payload")
+			}
+		}
+		ops[i] = op
+	}
+	return ops, errs
+}
+
+// expectedVersion reads the If-Match precondition of a write. It writes the
+// error response itself and returns false when the request cannot proceed.
+func (h *Handler) expectedVersion(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if h.requireIfMatch {
+			writeProblem(w, r, http.StatusPreconditionRequired, "If-Match header is required")
+			return 0, false
+		}
+		return 0, true
+	}
+
+	version, err := parseIfMatch(header)
+	if err != nil {
+		if errors.Is(err, ErrVersionMismatch) {
+			writeProblem(w, r, http.StatusPreconditionFailed, err.Error())
+			return 0, false
+		}
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return 0, false
+	}
+	return version, true
+}
+
+const (
+	batchModeAtomic     = "atomic"
+	batchModeBestEffort = "bestEffort"
+)
+
+type batchRequest struct {
+	Mode       string                  `json:"mode"`
+	Operations []batchOperationPayload `json:"operations"`
+}
+
+type batchOperationPayload struct {
+	Op      string          `json:"op"`
+	ID      *uuid.UUID      `json:"id"`
+	Version int64           `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type batchResponse struct {
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	Results   []batchItemResponse `json:"results"`
+}
+
+type batchItemResponse struct {
+	Index  int              `json:"index"`
+	Op     string           `json:"op"`
+	Status int              `json:"status"`
+	User   *User            `json:"user,omitempty"`
+	Error  *problem.Problem `json:"error,omitempty"`
+}
+
+// batchSuccessStatus mirrors the status of the equivalent single-user request.
+var batchSuccessStatus = map[string]int{
+	BatchCreate: http.StatusCreated,
+	BatchUpdate: http.StatusOK,
+	BatchDelete: http.StatusNoContent,
+}
+
+type listResponse struct {
+	Items      []User `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type auditResponse struct {
+	Items      []AuditRecord `json:"items"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// parseAuditQuery reads the time range and paging parameters of an audit
+// listing; allowUserID admits a userId filter for the global log.
+func parseAuditQuery(r *http.Request, allowUserID bool) (AuditQuery, error) {
+	q := r.URL.Query()
+	for key := range q {
+		switch key {
+		case "since", "until", "limit", "cursor":
+		case "userId":
+			if allowUserID {
+				continue
+			}
+			fallthrough
+		default:
+			return AuditQuery{}, fmt.Errorf("unknown query parameter %q", key)
+		}
+	}
+
+	aq := AuditQuery{Page: PageRequest{Cursor: q.Get("cursor")}}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return AuditQuery{}, fmt.Errorf("limit must be an integer between 1 and %d", MaxPageLimit)
+		}
+		aq.Page.Limit = limit
+	}
+	if v := q.Get("userId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return AuditQuery{}, errors.New("userId must be a UUID")
+		}
+		aq.UserID = &id
+	}
+
+	var err error
+	if aq.Since, err = parseTimeParam(q.Get("since"), "since"); err != nil {
+		return AuditQuery{}, err
+	}
+	if aq.Until, err = parseTimeParam(q.Get("until"), "until"); err != nil {
+		return AuditQuery{}, err
+	}
+	return aq, nil
+}
+
+// filterQueryParams are the query parameters that map onto Filter.
+var filterQueryParams = map[string]bool{
+	"includeDeleted": true,
+	"status":         true,
+	"emailDomain":    true,
+	"minAge":         true,
+	"maxAge":         true,
+	"createdAfter":   true,
+	"createdBefore":  true,
+	"updatedAfter":   true,
+	"updatedBefore":  true,
+}
+
+var listQueryParams = map[string]bool{
+	"limit":  true,
+	"cursor": true,
+	"sort":   true,
+}
+
+var exportQueryParams = map[string]bool{
+	"format":  true,
+	"columns": true,
+	"header":  true,
+	"sort":    true,
+}
+
+var exportContentTypes = map[string]string{
+	ExportCSV:    "text/csv; charset=utf-8",
+	ExportNDJSON: "application/x-ndjson",
+}
+
+func parseExportOptions(r *http.Request) (ExportOptions, error) {
+	q := r.URL.Query()
+	for key := range q {
+		if !exportQueryParams[key] && !filterQueryParams[key] {
+			return ExportOptions{}, fmt.Errorf("unknown query parameter %q", key)
+		}
+	}
+
+	opts := ExportOptions{Format: ExportCSV, Header: true}
+	if v := q.Get("format"); v != "" {
+		if _, ok := exportContentTypes[v]; !ok {
+			return ExportOptions{}, fmt.Errorf("format must be %s or %s", ExportCSV, ExportNDJSON)
+		}
+		opts.Format = v
+	}
+	if v := q.Get("header"); v != "" {
+		header, err := strconv.ParseBool(v)
+		if err != nil {
+			return ExportOptions{}, errors.New("header must be true or false")
+		}
+		opts.Header = header
+	}
+
+	var err error
+	if opts.Columns, err = ParseExportColumns(q.Get("columns")); err != nil {
+		return ExportOptions{}, err
+	}
+	if opts.Sort, err = ParseSort(q.Get("sort")); err != nil {
+		return ExportOptions{}, err
+	}
+	if opts.Filter, err = parseFilter(q); err != nil {
+		return ExportOptions{}, err
+	}
+	return opts, nil
+}
+
+// exportResponse defers the response headers until the first write, so that
+// an export failing before producing output can still answer with an error.
+type exportResponse struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (e *exportResponse) start() {
+	e.started = true
+	e.w.Header().Set("Content-Type", e.contentType)
+	e.w.Header().Set("Content-Disposition", `attachment; filename="`+e.filename+`"`)
+	e.w.WriteHeader(http.StatusOK)
+}
+
+func (e *exportResponse) Write(p []byte) (int, error) {
+	if !e.started {
+		e.start()
+	}
+	return e.w.Write(p)
+}
+
+// maxImportBytes bounds the size of an import upload.
+const maxImportBytes = 10 << 20
+
+var importFormats = map[string]string{
+	"text/csv":             ImportCSV,
+	"application/x-ndjson": ImportNDJSON,
+	"application/ndjson":   ImportNDJSON,
+}
+
+type importResponse struct {
+	DryRun   bool                `json:"dryRun"`
+	Created  int                 `json:"created"`
+	Skipped  int                 `json:"skipped"`
+	Rejected int                 `json:"rejected"`
+	Rows     []importRowResponse `json:"rows"`
+}
+
+type importRowResponse struct {
+	Row    int                  `json:"row"`
+	Status string               `json:"status"`
+	User   *User                `json:"user,omitempty"`
+	Reason string               `json:"reason,omitempty"`
+	Errors []problem.FieldError `json:"errors,omitempty"`
+}
+
+type searchResponse struct {
+	Items []SearchResult `json:"items"`
+}
+
+func parseListOptions(r *http.Request) (ListOptions, error) {
+	q := r.URL.Query()
+	for key := range q {
+		if !listQueryParams[key] && !filterQueryParams[key] {
+			return ListOptions{}, fmt.Errorf("unknown query parameter %q", key)
+		}
+	}
+
+	opts := ListOptions{Page: PageRequest{Cursor: q.Get("cursor")}}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return ListOptions{}, fmt.Errorf("limit must be an integer between 1 and %d", MaxPageLimit)
+		}
+		opts.Page.Limit = limit
+	}
+
+	sort, err := ParseSort(q.Get("sort"))
+	if err != nil {
+		return ListOptions{}, err
+	}
+	opts.Sort = sort
+
+	if opts.Filter, err = parseFilter(q); err != nil {
+		return ListOptions{}, err
+	}
+	return opts, nil
+}
+
+// parseFilter reads the filterQueryParams shared by listing and export.
+func parseFilter(q url.Values) (Filter, error) {
+	var f Filter
+	var err error
+	if v := q.Get("includeDeleted"); v != "" {
+		if f.IncludeDeleted, err = strconv.ParseBool(v); err != nil {
+			return Filter{}, errors.New("includeDeleted must be true or false")
+		}
+	}
+	if v := q.Get("status"); v != "" {
+		if v != StatusActive && v != StatusInactive {
+			return Filter{}, fmt.Errorf("status must be %s or %s", StatusActive, StatusInactive)
+		}
+		f.Status = v
+	}
+	f.EmailDomain = q.Get("emailDomain")
+	if f.MinAge, err = parseAgeParam(q.Get("minAge"), "minAge"); err != nil {
+		return Filter{}, err
+	}
+	if f.MaxAge, err = parseAgeParam(q.Get("maxAge"), "maxAge"); err != nil {
+		return Filter{}, err
+	}
+	if f.MinAge != nil && f.MaxAge != nil && *f.MinAge > *f.MaxAge {
+		return Filter{}, errors.New("minAge must not exceed maxAge")
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"createdAfter", &f.CreatedAfter},
+		{"createdBefore", &f.CreatedBefore},
+		{"updatedAfter", &f.UpdatedAfter},
+		{"updatedBefore", &f.UpdatedBefore},
+	} {
+		if *p.dst, err = parseTimeParam(q.Get(p.name), p.name); err != nil {
+			return Filter{}, err
+		}
+	}
+	return f, nil
+}
+
+func parseAgeParam(v, name string) (*int, error) {
+	if v == "" {
+		return nil, nil
+	}
+	age, err := strconv.Atoi(v)
+	if err != nil || age < 1 {
+		return nil, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return &age, nil
+}
+
+func parseTimeParam(v, name string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	return &t, nil
+}
+
+func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	u, err := h.svc.Restore(r.Context(), id)
+	if err != nil {
+		handleRepoError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(u))
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (h *Handler) UserAudit(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	q, err := parseAuditQuery(r, false)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	q.UserID = &id
+	h.writeAudit(w, r, q)
+}
+
+func (h *Handler) Audit(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r, true)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.writeAudit(w, r, q)
+}
+
+func (h *Handler) writeAudit(w http.ResponseWriter, r *http.Request, q AuditQuery) {
+	page, err := h.svc.ListAudit(r.Context(), q)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		handleRepoError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, auditResponse{Items: page.Records, NextCursor: page.NextCursor})
+}
+
 func parseID(r *http.Request) (uuid.UUID, error) {
 	return uuid.Parse(chi.URLParam(r, "id"))
 }
 
-func handleRepoError(w http.ResponseWriter, err error) {
-	if errors.Is(err, ErrNotFound) {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": ErrNotFound.Error()})
-		return
+// handleRepoError reports a service error as a problem. This is where such
+// errors are logged; the service and repository only return them.
+func handleRepoError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problemFor(err)
+	logError(r.Context(), p.Status, err)
+	problem.Write(w, r, p)
+}
+
+// internalError logs err and reports a 500 with detail.
+func internalError(w http.ResponseWriter, r *http.Request, err error, detail string) {
+	logError(r.Context(), http.StatusInternalServerError, err)
+	writeProblem(w, r, http.StatusInternalServerError, detail)
+}
+
+// logError logs an error answered with status: server errors at error level,
+// client errors, which are expected, at debug level.
+func logError(ctx context.Context, status int, err error, attrs ...slog.Attr) {
+	level, msg := slog.LevelDebug, "request rejected"
+	if status >= http.StatusInternalServerError {
+		level, msg = slog.LevelError, "request failed"
+	}
+	attrs = append(attrs, slog.Int("status", status), slog.String("error", err.Error()))
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// problemFor maps a service error to the problem reported to clients.
+func problemFor(err error) *problem.Problem {
+	var validationErrs validator.ValidationErrors
+	var forbidden *ForbiddenError
+	switch {
+	case errors.As(err, &forbidden):
+		p := problem.New(http.StatusForbidden, forbidden.Error()).WithCode(problemTypeForbidden, "policy_denied")
+		p.Rule = forbidden.Rule
+		return p
+	case errors.As(err, &validationErrs):
+		return problem.Validation(validationErrs)
+	case errors.Is(err, auth.ErrWeakPassword):
+		return problem.New(http.StatusBadRequest, err.Error()).WithCode(problemTypeWeakPassword, "weak_password")
+	case errors.Is(err, ErrInvalidVerificationToken):
+		return problem.New(http.StatusBadRequest, ErrInvalidVerificationToken.Error()).WithCode(problemTypeVerification, "invalid_verification_token")
+	case errors.Is(err, ErrIncorrectPassword):
+		return problem.New(http.StatusForbidden, err.Error()).WithCode(problemTypeForbidden, "incorrect_password")
+	case errors.Is(err, ErrNoUpdates):
+		return problem.New(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNotFound):
+		return problem.New(http.StatusNotFound, ErrNotFound.Error())
+	case errors.Is(err, ErrVersionMismatch):
+		return problem.New(http.StatusPreconditionFailed, ErrVersionMismatch.Error())
+	case errors.Is(err, ErrNotDeleted):
+		return problem.New(http.StatusConflict, ErrNotDeleted.Error())
+	case errors.Is(err, ErrEmailTaken):
+		return problem.New(http.StatusConflict, ErrEmailTaken.Error()).WithCode(problemTypeEmailTaken, "email_taken")
+	case errors.Is(err, ErrConstraintViolation):
+		return problem.New(http.StatusBadRequest, err.Error()).WithCode(problemTypeConstraint, "constraint_violation")
+	case errors.Is(err, ErrBatchRolledBack):
+		return problem.New(http.StatusFailedDependency, err.Error())
+	default:
+		return problem.New(http.StatusInternalServerError, "internal server error")
 	}
-	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	problem.Write(w, r, problem.New(status, detail))
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload any) {
@@ -2,12 +2,20 @@ package user
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 
+	"go-crud/internal/problem"
+
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
 )
 
 func newTestHandler() *Handler {
@@ -50,3 +58,401 @@ func TestPatchRejectsEmptyPayload(t *testing.T) {
 		t.Fatalf("expected 400 for empty patch payload, got %d", res.Code)
 	}
 }
+
+func TestListRejectsInvalidLimit(t *testing.T) {
+	h := newTestHandler()
+	r := chi.NewRouter()
+	h.RegisterRoutes(r)
+
+	for _, limit := range []string{"0", "abc", "10000"} {
+		req := httptest.NewRequest(http.MethodGet, "/users?limit="+limit, nil)
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for limit=%s, got %d", limit, res.Code)
+		}
+	}
+}
+
+func TestListReturnsPageEnvelope(t *testing.T) {
+	var got PageRequest
+	h := NewHandler(NewService(stubRepo{
+		listFn: func(_ context.Context, opts ListOptions) (Page, error) {
+			got = opts.Page
+			return Page{Users: []User{{FirstName: "Jane"}}, NextCursor: "next"}, nil
+		},
+	}))
+	r := chi.NewRouter()
+	h.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/users?limit=1&cursor=abc", nil)
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.Code)
+	}
+	if got.Limit != 1 || got.Cursor != "abc" {
+		t.Fatalf("unexpected page request: %+v", got)
+	}
+
+	var body struct {
+		Items      []User `json:"items"`
+		NextCursor string `json:"nextCursor"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(body.Items) != 1 || body.NextCursor != "next" {
+		t.Fatalf("unexpected envelope: %+v", body)
+	}
+}
+
+func TestListRejectsUnknownFilterAndSortFields(t *testing.T) {
+	h := newTestHandler()
+	r := chi.NewRouter()
+	h.RegisterRoutes(r)
+
+	for _, query := range []string{"nickname=bob", "sort=-password", "status=Deleted", "minAge=40&maxAge=30", "createdAfter=yesterday"} {
+		req := httptest.NewRequest(http.MethodGet, "/users?"+query, nil)
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", query, res.Code)
+		}
+	}
+}
+
+func TestGetByIDHonoursIfNoneMatch(t *testing.T) {
+	id := uuid.New()
+	h := NewHandler(NewService(stubRepo{
+		getFn: func(context.Context, uuid.UUID) (User, error) {
+			return User{UserID: id, Version: 3}, nil
+		},
+	}))
+	r := chi.NewRouter()
+	h.RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/"+id.String(), nil)
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || res.Header().Get("ETag") != `"3"` {
+		t.Fatalf("expected 200 with ETag \"3\", got %d %q", res.Code, res.Header().Get("ETag"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/users/"+id.String(), nil)
+	req.Header.Set("If-None-Match", `"2", W/"3"`)
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if res.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for matching If-None-Match, got %d", res.Code)
+	}
+}
+
+func TestPatchPreconditions(t *testing.T) {
+	var gotVersion int64
+	h := NewHandler(NewService(stubRepo{
+		updateFn: func(_ context.Context, _ uuid.UUID, _ UpdateUserRequest, expectedVersion int64) (User, error) {
+			gotVersion = expectedVersion
+			if expectedVersion != 0 && expectedVersion != 4 {
+				return User{}, ErrVersionMismatch
+			}
+			return User{Version: 5}, nil
+		},
+	}), WithRequireIfMatch(true))
+	r := chi.NewRouter()
+	h.RegisterRoutes(r)
+
+	cases := []struct {
+		ifMatch     string
+		wantStatus  int
+		wantVersion int64
+	}{
+		{"", http.StatusPreconditionRequired, 0},
+		{`"3"`, http.StatusPreconditionFailed, 3},
+		{`W/"4"`, http.StatusPreconditionFailed, 0},
+		{`"3", "4"`, http.StatusBadRequest, 0},
+		{`"4"`, http.StatusOK, 4},
+		{"*", http.StatusOK, 0},
+	}
+	for _, c := range cases {
+		gotVersion = 0
+		body, _ := json.Marshal(map[string]any{"firstName": "Jane"})
+		req := httptest.NewRequest(http.MethodPatch, "/users/550e8400-e29b-41d4-a716-446655440000", bytes.NewReader(body))
+		if c.ifMatch != "" {
+			req.Header.Set("If-Match", c.ifMatch)
+		}
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != c.wantStatus || gotVersion != c.wantVersion {
+			t.Fatalf("If-Match %q: got status %d version %d, want %d version %d", c.ifMatch, res.Code, gotVersion, c.wantStatus, c.wantVersion)
+		}
+	}
+}
+
+func TestCreateReturnsConflictForTakenEmail(t *testing.T) {
+	h := NewHandler(NewService(stubRepo{
+		createFn: func(context.Context, CreateUserRequest) (User, error) {
+			return User{}, ErrEmailTaken
+		},
+	}))
+	r := chi.NewRouter()
+	h.RegisterRoutes(r)
+
+	body, _ := json.Marshal(map[string]any{"firstName": "John", "lastName": "Doe", "email": "john@example.com"})
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", res.Code)
+	}
+
+	var got problem.Problem
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Code != "email_taken" {
+		t.Fatalf("expected code email_taken, got %q", got.Code)
+	}
+}
+
+func TestRestoreReturnsConflictForLiveUser(t *testing.T) {
+	id := uuid.New()
+	h := NewHandler(NewService(stubRepo{
+		lockFn: func(context.Context, uuid.UUID, bool) (User, error) {
+			return User{UserID: id, Email: "john@example.com"}, nil
+		},
+		restoreFn: func(context.Context, uuid.UUID) (User, error) {
+			t.Fatal("restore called for a live user")
+			return User{}, nil
+		},
+	}))
+	r := chi.NewRouter()
+	h.RegisterRoutes(r)
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/users/"+id.String()+"/restore", nil))
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", res.Code, res.Body)
+	}
+	var got problem.Problem
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Detail != ErrNotDeleted.Error() {
+		t.Fatalf("unexpected problem: %+v", got)
+	}
+}
+
+func TestCreateReportsValidationErrorsAsProblem(t *testing.T) {
+	h := newTestHandler()
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	h.RegisterRoutes(r)
+
+	body, _ := json.Marshal(map[string]any{"firstName": "J", "lastName": "Doe", "email": "not-an-email"})
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", res.Code)
+	}
+	if ct := res.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("expected %s, got %q", problem.ContentType, ct)
+	}
+
+	var got problem.Problem
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Type != problem.TypeValidation || got.Status != http.StatusBadRequest || got.Instance == "" {
+		t.Fatalf("unexpected problem: %+v", got)
+	}
+	want := []problem.FieldError{
+		{Field: "firstName", Rule: "min", Message: "firstName must be at least 2 characters"},
+		{Field: "email", Rule: "email", Message: "email must be a valid email address"},
+	}
+	if !reflect.DeepEqual(got.Errors, want) {
+		t.Fatalf("unexpected field errors: %+v", got.Errors)
+	}
+}
+
+func TestBatchReportsPerItemStatus(t *testing.T) {
+	id := uuid.New()
+	svc := NewService(stubRepo{
+		createFn: func(_ context.Context, input CreateUserRequest) (User, error) {
+			return User{UserID: uuid.New(), Email: input.Email, Version: 1}, nil
+		},
+		deleteFn: func(context.Context, uuid.UUID, int64) error { return ErrNotFound },
+	})
+	r := chi.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	body, _ := json.Marshal(map[string]any{
+		"mode": "bestEffort",
+		"operations": []map[string]any{
+			{"op": "create", "data": map[string]any{"firstName": "Ada", "lastName": "Lovelace", "email": "ada@example.com"}},
+			{"op": "create", "data": map[string]any{"firstName": "Bad", "lastName": "Email", "email": "nope"}},
+			{"op": "delete", "id": id},
+		},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/users:batch", bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	var got batchResponse
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	statuses := []int{got.Results[0].Status, got.Results[1].Status, got.Results[2].Status}
+	if want := []int{http.StatusCreated, http.StatusBadRequest, http.StatusNotFound}; !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("expected statuses %v, got %v", want, statuses)
+	}
+	if got.Succeeded != 1 || got.Failed != 2 {
+		t.Fatalf("expected 1 succeeded and 2 failed, got %d and %d", got.Succeeded, got.Failed)
+	}
+	if got.Results[1].Error == nil || len(got.Results[1].Error.Errors) != 1 || got.Results[1].Error.Errors[0].Field != "email" {
+		t.Fatalf("expected email validation error, got %+v", got.Results[1].Error)
+	}
+}
+
+func TestBatchRejectsMalformedOperations(t *testing.T) {
+	r := chi.NewRouter()
+	newTestHandler().RegisterRoutes(r)
+
+	body, _ := json.Marshal(map[string]any{
+		"operations": []map[string]any{
+			{"op": "upsert"},
+			{"op": "update", "data": map[string]any{"firstName": "Ada"}},
+		},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/users:batch", bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", res.Code)
+	}
+	var p problem.Problem
+	if err := json.NewDecoder(res.Body).Decode(&p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	var fields []string
+	for _, fe := range p.Errors {
+		fields = append(fields, fe.Field)
+	}
+	if want := []string{"operations[0].op", "operations[1].id"}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("expected errors for %v, got %v", want, fields)
+	}
+}
+
+func TestExportStreamsFilteredUsers(t *testing.T) {
+	var gotFilter Filter
+	svc := NewService(stubRepo{
+		exportFn: func(_ context.Context, f Filter, _ []SortField, fn func(User) error) error {
+			gotFilter = f
+			for _, name := range []string{"Ada", "Alan"} {
+				if err := fn(User{FirstName: name, Status: StatusActive}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+	r := chi.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/export?format=csv&columns=firstName,status&status=Active", nil)
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	if ct := res.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if want := "firstName,status\nAda,Active\nAlan,Active\n"; res.Body.String() != want {
+		t.Fatalf("unexpected body %q", res.Body.String())
+	}
+	if gotFilter.Status != StatusActive {
+		t.Fatalf("expected status filter to reach the repository, got %+v", gotFilter)
+	}
+}
+
+func TestExportRejectsInvalidOptions(t *testing.T) {
+	r := chi.NewRouter()
+	newTestHandler().RegisterRoutes(r)
+
+	for _, query := range []string{"format=xml", "columns=password", "header=maybe", "limit=10"} {
+		req := httptest.NewRequest(http.MethodGet, "/users/export?"+query, nil)
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", query, res.Code)
+		}
+	}
+}
+
+func TestExportReportsFailureBeforeOutput(t *testing.T) {
+	svc := NewService(stubRepo{
+		exportFn: func(context.Context, Filter, []SortField, func(User) error) error {
+			return errors.New("connection refused")
+		},
+	})
+	r := chi.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/export?format=ndjson", nil)
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+
+	if res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", res.Code)
+	}
+	if ct := res.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("expected problem response, got %q", ct)
+	}
+}
+
+func TestImportRequiresSupportedContentType(t *testing.T) {
+	r := chi.NewRouter()
+	newTestHandler().RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodPost, "/users/import", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+
+	if res.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", res.Code)
+	}
+}
+
+func TestImportReportsRejectedRows(t *testing.T) {
+	r := chi.NewRouter()
+	newTestHandler().RegisterRoutes(r)
+
+	body := `{"firstName":"Ada","lastName":"Lovelace","email":"not-an-email"}` + "\n"
+	req := httptest.NewRequest(http.MethodPost, "/users/import?dryRun=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	var got importResponse
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !got.DryRun || got.Rejected != 1 || len(got.Rows) != 1 {
+		t.Fatalf("unexpected report: %+v", got)
+	}
+	if row := got.Rows[0]; row.Row != 1 || len(row.Errors) != 1 || row.Errors[0].Field != "email" {
+		t.Fatalf("expected email validation error on row 1, got %+v", row)
+	}
+}
@@ -0,0 +1,231 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	db "go-crud/internal/db/sqlc"
+	"go-crud/internal/problem"
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+// StoredResponse is a response recorded under an idempotency key, replayed
+// verbatim when the request is retried.
+type StoredResponse struct {
+	StatusCode int
+	Header     map[string]string
+	Body       []byte
+}
+
+// IdempotencyStore records responses to requests carrying an
+// Idempotency-Key. Keys are scoped to the actor that sent them.
+type IdempotencyStore interface {
+	// Reserve claims key for a request with the given fingerprint until ttl
+	// elapses. If the key already holds a response to the same request,
+	// that response is returned instead; a different fingerprint fails
+	// with ErrIdempotencyKeyReused, and an unfinished request with
+	// ErrIdempotencyKeyInProgress.
+	Reserve(ctx context.Context, actor, key, fingerprint string, ttl time.Duration) (*StoredResponse, error)
+	// Complete stores the response to the request that reserved key.
+	Complete(ctx context.Context, actor, key string, resp StoredResponse) error
+	// Release drops a reservation so that the request can be retried.
+	Release(ctx context.Context, actor, key string) error
+	// PurgeExpired removes expired keys and reports how many were removed.
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type PostgresIdempotencyStore struct {
+	q *db.Queries
+}
+
+func NewPostgresIdempotencyStore(conn *sql.DB) *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{q: db.New(conn)}
+}
+
+// reserveAttempts bounds how often Reserve retries a key that disappears
+// between its insert conflicting and its read.
+const reserveAttempts = 3
+
+func (s *PostgresIdempotencyStore) Reserve(ctx context.Context, actor, key, fingerprint string, ttl time.Duration) (*StoredResponse, error) {
+	for range reserveAttempts {
+		n, err := s.q.ReserveIdempotencyKey(ctx, db.ReserveIdempotencyKeyParams{
+			Actor:          actor,
+			IdempotencyKey: key,
+			Fingerprint:    fingerprint,
+			ExpiresAt:      time.Now().Add(ttl),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if n == 1 {
+			return nil, nil
+		}
+
+		row, err := s.q.GetIdempotencyKey(ctx, db.GetIdempotencyKeyParams{Actor: actor, IdempotencyKey: key})
+		if errors.Is(err, sql.ErrNoRows) {
+			// Released or purged since the insert conflicted; try again.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return storedResponse(row, fingerprint)
+	}
+	return nil, fmt.Errorf("%w: key was released %d times while reserving it", ErrIdempotencyKeyInProgress, reserveAttempts)
+}
+
+// storedResponse checks a key that was already reserved against the
+// request's fingerprint and returns its recorded response.
+func storedResponse(row db.IdempotencyKey, fingerprint string) (*StoredResponse, error) {
+	if row.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !row.StatusCode.Valid {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+
+	resp := &StoredResponse{StatusCode: int(row.StatusCode.Int32), Body: row.ResponseBody}
+	if err := json.Unmarshal(row.ResponseHeaders, &resp.Header); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *PostgresIdempotencyStore) Complete(ctx context.Context, actor, key string, resp StoredResponse) error {
+	header, err := json.Marshal(resp.Header)
+	if err != nil {
+		return err
+	}
+	return s.q.CompleteIdempotencyKey(ctx, db.CompleteIdempotencyKeyParams{
+		Actor:           actor,
+		IdempotencyKey:  key,
+		StatusCode:      sql.NullInt32{Int32: int32(resp.StatusCode), Valid: true},
+		ResponseHeaders: header,
+		ResponseBody:    resp.Body,
+	})
+}
+
+func (s *PostgresIdempotencyStore) Release(ctx context.Context, actor, key string) error {
+	return s.q.DeleteIdempotencyKey(ctx, db.DeleteIdempotencyKeyParams{Actor: actor, IdempotencyKey: key})
+}
+
+func (s *PostgresIdempotencyStore) PurgeExpired(ctx context.Context) (int64, error) {
+	return s.q.DeleteExpiredIdempotencyKeys(ctx)
+}
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotentBodyBytes bounds the body buffered to fingerprint a request,
+// leaving ample room for any user being created.
+const maxIdempotentBodyBytes = 64 << 10
+
+// replayedHeaders are the response headers stored with a response and
+// restored on replay.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotent runs next at most once per Idempotency-Key and actor. Retries of
+// the same request get the recorded response; a key reused for a different
+// request gets 422. Server errors are not recorded, so they can be retried.
+func (h *Handler) idempotent(w http.ResponseWriter, r *http.Request, key string, next http.HandlerFunc) {
+	if len(key) > maxIdempotencyKeyLength {
+		writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxIdempotentBodyBytes))
+			return
+		}
+		writeProblem(w, r, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	ctx := r.Context()
+	actor := ActorFromContext(ctx)
+	stored, err := h.idempotency.Reserve(ctx, actor, key, requestFingerprint(r, body), h.idempotencyTTL)
+	switch {
+	case errors.Is(err, ErrIdempotencyKeyReused):
+		problem.Write(w, r, problem.New(http.StatusUnprocessableEntity, err.Error()).WithCode(problemTypeIdempotency, "idempotency_key_reused"))
+		return
+	case errors.Is(err, ErrIdempotencyKeyInProgress):
+		problem.Write(w, r, problem.New(http.StatusConflict, err.Error()).WithCode(problemTypeIdempotency, "idempotency_key_in_progress"))
+		return
+	case err != nil:
+		internalError(w, r, err, "internal server error")
+		return
+	case stored != nil:
+		for name, v := range stored.Header {
+			w.Header().Set(name, v)
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(stored.StatusCode)
+		_, _ = w.Write(stored.Body)
+		return
+	}
+
+	rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	next(rec, r)
+
+	// Record the outcome even if the client has gone away, since that is
+	// exactly when it will retry.
+	ctx = context.WithoutCancel(ctx)
+	if rec.status >= http.StatusInternalServerError {
+		err = h.idempotency.Release(ctx, actor, key)
+	} else {
+		resp := StoredResponse{StatusCode: rec.status, Header: make(map[string]string), Body: rec.body.Bytes()}
+		for _, name := range replayedHeaders {
+			if v := rec.Header().Get(name); v != "" {
+				resp.Header[name] = v
+			}
+		}
+		err = h.idempotency.Complete(ctx, actor, key, resp)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "record idempotency key", "error", err)
+	}
+}
+
+// requestFingerprint identifies a request by method, path and exact body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping a copy of its
+// status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	rr.body.Write(p)
+	return rr.ResponseWriter.Write(p)
+}
@@ -0,0 +1,130 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// memIdempotencyStore implements IdempotencyStore in memory, without expiry.
+type memIdempotencyStore struct {
+	keys map[string]*memIdempotencyEntry
+}
+
+type memIdempotencyEntry struct {
+	fingerprint string
+	resp        *StoredResponse
+}
+
+func (m *memIdempotencyStore) Reserve(_ context.Context, actor, key, fingerprint string, _ time.Duration) (*StoredResponse, error) {
+	e, ok := m.keys[actor+"/"+key]
+	if !ok {
+		m.keys[actor+"/"+key] = &memIdempotencyEntry{fingerprint: fingerprint}
+		return nil, nil
+	}
+	if e.fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if e.resp == nil {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return e.resp, nil
+}
+
+func (m *memIdempotencyStore) Complete(_ context.Context, actor, key string, resp StoredResponse) error {
+	m.keys[actor+"/"+key].resp = &resp
+	return nil
+}
+
+func (m *memIdempotencyStore) Release(_ context.Context, actor, key string) error {
+	delete(m.keys, actor+"/"+key)
+	return nil
+}
+
+func (m *memIdempotencyStore) PurgeExpired(context.Context) (int64, error) {
+	return 0, nil
+}
+
+func TestCreateReplaysIdempotentRequests(t *testing.T) {
+	calls := 0
+	fail := false
+	svc := NewService(stubRepo{
+		createFn: func(_ context.Context, input CreateUserRequest) (User, error) {
+			calls++
+			if fail {
+				return User{}, errors.New("connection reset")
+			}
+			return User{UserID: uuid.New(), Email: input.Email, Version: 1}, nil
+		},
+	})
+	store := &memIdempotencyStore{keys: make(map[string]*memIdempotencyEntry)}
+	r := chi.NewRouter()
+	NewHandler(svc, WithIdempotency(store, time.Hour)).RegisterRoutes(r)
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(body))
+		req.Header.Set("Idempotency-Key", key)
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		return res
+	}
+	body := `{"firstName":"Ada","lastName":"Lovelace","email":"ada@example.com"}`
+
+	first := post("k1", body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", first.Code)
+	}
+	replay := post("k1", body)
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() {
+		t.Fatalf("expected replay of original response, got %d %s", replay.Code, replay.Body.String())
+	}
+	if replay.Header().Get("Idempotent-Replayed") != "true" || replay.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Fatalf("unexpected replay headers: %v", replay.Header())
+	}
+	if calls != 1 {
+		t.Fatalf("expected one create, got %d", calls)
+	}
+
+	if res := post("k1", `{"firstName":"Alan","lastName":"Turing","email":"alan@example.com"}`); res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for reused key, got %d", res.Code)
+	}
+
+	fail = true
+	if res := post("k2", body); res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", res.Code)
+	}
+	fail = false
+	if res := post("k2", body); res.Code != http.StatusCreated {
+		t.Fatalf("expected retry after server error to run again, got %d", res.Code)
+	}
+	if calls != 3 {
+		t.Fatalf("expected three creates, got %d", calls)
+	}
+}
+
+func TestCreateRejectsOversizedIdempotentRequests(t *testing.T) {
+	store := &memIdempotencyStore{keys: make(map[string]*memIdempotencyEntry)}
+	r := chi.NewRouter()
+	NewHandler(NewService(stubRepo{}), WithIdempotency(store, time.Hour)).RegisterRoutes(r)
+
+	body := `{"firstName":"` + strings.Repeat("a", maxIdempotentBodyBytes) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", "k1")
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+
+	if res.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d: %s", res.Code, res.Body)
+	}
+	if len(store.keys) != 0 {
+		t.Fatalf("expected no key to be reserved, got %v", store.keys)
+	}
+}
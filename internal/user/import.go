@@ -0,0 +1,255 @@
+package user
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+)
+
+// MaxImportRows bounds the number of data rows in one import.
+const MaxImportRows = 10000
+
+const (
+	ImportCreated  = "created"
+	ImportSkipped  = "skipped"
+	ImportRejected = "rejected"
+)
+
+var (
+	ErrInvalidImport = errors.New("invalid import")
+	// errDryRun rolls back a dry-run import once its results are known.
+	errDryRun = errors.New("dry run")
+)
+
+// ImportRowResult is the outcome of one row of an import. Row is the line
+// number in the upload. User is set for created rows; Err explains rejected
+// rows and Reason skipped ones.
+type ImportRowResult struct {
+	Row    int
+	Status string
+	User   *User
+	Reason string
+	Err    error
+}
+
+// ImportReport lists the outcome of every row of an import, in upload order.
+type ImportReport struct {
+	DryRun bool
+	Rows   []ImportRowResult
+}
+
+// importRow is one parsed row, or the reason it could not be parsed.
+type importRow struct {
+	line  int
+	input CreateUserRequest
+	err   error
+}
+
+// Import creates a user for every valid row of r, which holds CSV with a
+// header row or NDJSON. Rows failing validation are rejected, and rows whose
+// email is already registered, or appeared earlier in the upload, are skipped.
+// A dry run reports the same results without creating anyone.
+func (s *Service) Import(ctx context.Context, format string, r io.Reader, dryRun bool) (_ ImportReport, err error) {
+	ctx, end := startSpan(ctx, "Import", attribute.String("import.format", format), attribute.Bool("import.dry_run", dryRun))
+	defer end(&err)
+
+	if err := s.authorize(ctx, Operation{Action: ActionImport}); err != nil {
+		return ImportReport{}, err
+	}
+	var rows []importRow
+	switch format {
+	case ImportCSV:
+		rows, err = parseCSVImport(r)
+	case ImportNDJSON:
+		rows, err = parseNDJSONImport(r)
+	default:
+		err = fmt.Errorf("%w: format must be %s or %s", ErrInvalidImport, ImportCSV, ImportNDJSON)
+	}
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	report := ImportReport{DryRun: dryRun, Rows: make([]ImportRowResult, len(rows))}
+	var inputs []CreateUserRequest
+	byEmail := make(map[string]int)
+	for i, row := range rows {
+		res := &report.Rows[i]
+		res.Row = row.line
+		err := row.err
+		if err == nil {
+			err = s.validate.Struct(row.input)
+		}
+		if err == nil {
+			err = s.authorize(ctx, createOperation(row.input))
+		}
+		if err != nil {
+			res.Status, res.Err = ImportRejected, err
+			continue
+		}
+		if first, ok := byEmail[row.input.Email]; ok {
+			res.Status, res.Reason = ImportSkipped, fmt.Sprintf("duplicate of row %d", rows[first].line)
+			continue
+		}
+		byEmail[row.input.Email] = i
+		inputs = append(inputs, row.input)
+	}
+	if len(inputs) == 0 {
+		return report, nil
+	}
+
+	var out outbox
+	err = s.repo.WithTx(ctx, func(tx Repository) error {
+		created, err := tx.BulkCreate(ctx, inputs)
+		if err != nil {
+			return err
+		}
+		for _, u := range created {
+			res := &report.Rows[byEmail[u.Email]]
+			res.Status = ImportCreated
+			if dryRun {
+				continue
+			}
+			res.User = &u
+			if err := tx.RecordAudit(ctx, newAuditRecord(ctx, AuditCreate, nil, u)); err != nil {
+				return err
+			}
+			if err := s.requestVerification(ctx, tx, u, &out); err != nil {
+				return err
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return ImportReport{}, err
+	}
+	s.send(ctx, out)
+
+	for _, i := range byEmail {
+		if report.Rows[i].Status == "" {
+			report.Rows[i].Status, report.Rows[i].Reason = ImportSkipped, ErrEmailTaken.Error()
+		}
+	}
+	return report, nil
+}
+
+// importFields are the accepted CSV header names, matching the JSON names of
+// CreateUserRequest.
+var importFields = map[string]func(in *CreateUserRequest, v string) error{
+	"firstName": func(in *CreateUserRequest, v string) error { in.FirstName = v; return nil },
+	"lastName":  func(in *CreateUserRequest, v string) error { in.LastName = v; return nil },
+	"email":     func(in *CreateUserRequest, v string) error { in.Email = v; return nil },
+	"phone":     func(in *CreateUserRequest, v string) error { in.Phone = v; return nil },
+	"status":    func(in *CreateUserRequest, v string) error { in.Status = v; return nil },
+	"age": func(in *CreateUserRequest, v string) error {
+		if v == "" {
+			return nil
+		}
+		age, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.New("age must be an integer")
+		}
+		in.Age = &age
+		return nil
+	},
+}
+
+// parseCSVImport reads a header row naming importFields followed by one user
+// per row. Cells are trimmed and empty cells leave the field unset.
+func parseCSVImport(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: missing header row", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+
+	seen := make(map[string]bool)
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if importFields[name] == nil {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidImport, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidImport, name)
+		}
+		seen[name] = true
+		header[i] = name
+	}
+
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+		}
+		if len(rows) == MaxImportRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrInvalidImport, MaxImportRows)
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := importRow{line: line}
+		if err != nil {
+			row.err = fmt.Errorf("expected %d fields, got %d", len(header), len(record))
+		} else {
+			for i, v := range record {
+				if err := importFields[header[i]](&row.input, strings.TrimSpace(v)); err != nil {
+					row.err = err
+					break
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// parseNDJSONImport reads one CreateUserRequest object per line. Blank lines
+// are ignored.
+func parseNDJSONImport(r io.Reader) ([]importRow, error) {
+	sc := bufio.NewScanner(r)
+	var rows []importRow
+	for line := 1; sc.Scan(); line++ {
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		if len(rows) == MaxImportRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrInvalidImport, MaxImportRows)
+		}
+
+		row := importRow{line: line}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&row.input); err != nil {
+			row.err = fmt.Errorf("invalid JSON: %v", err)
+		} else if row.input.Password != "" {
+			row.err = errors.New("passwords cannot be imported")
+		}
+		rows = append(rows, row)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,113 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseCSVImport(t *testing.T) {
+	in := "\ufefffirstName, lastName,email,age\n" +
+		"Ada,Lovelace,ada@example.com,36\n" +
+		"Alan,Turing,alan@example.com,forty\n" +
+		"Grace,Hopper\n"
+
+	rows, err := parseCSVImport(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	if rows[0].line != 2 || rows[0].err != nil || rows[0].input.Email != "ada@example.com" || *rows[0].input.Age != 36 {
+		t.Fatalf("unexpected first row: %+v", rows[0])
+	}
+	if rows[1].err == nil || rows[1].line != 3 {
+		t.Fatalf("expected age error on line 3, got %+v", rows[1])
+	}
+	if rows[2].err == nil || rows[2].line != 4 {
+		t.Fatalf("expected field count error on line 4, got %+v", rows[2])
+	}
+
+	for _, bad := range []string{"", "firstName,password\n", "email,email\n", "email\n\"unterminated\n"} {
+		if _, err := parseCSVImport(strings.NewReader(bad)); !errors.Is(err, ErrInvalidImport) {
+			t.Fatalf("expected ErrInvalidImport for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestParseNDJSONImport(t *testing.T) {
+	in := `{"firstName":"Ada","lastName":"Lovelace","email":"ada@example.com"}` + "\n\n" +
+		`{"firstName":"Alan","password":"secret"}` + "\n" +
+		`not json` + "\n"
+
+	rows, err := parseNDJSONImport(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected blank line to be skipped, got %d rows", len(rows))
+	}
+	if rows[0].err != nil || rows[0].input.FirstName != "Ada" {
+		t.Fatalf("unexpected first row: %+v", rows[0])
+	}
+	if rows[1].line != 3 || rows[1].err == nil {
+		t.Fatalf("expected unknown field to be rejected on line 3, got %+v", rows[1])
+	}
+	if rows[2].line != 4 || rows[2].err == nil {
+		t.Fatalf("expected invalid JSON on line 4, got %+v", rows[2])
+	}
+}
+
+func TestServiceImportReportsEveryRow(t *testing.T) {
+	var audited int
+	repo := stubRepo{
+		bulkFn: func(_ context.Context, inputs []CreateUserRequest) ([]User, error) {
+			var created []User
+			for _, in := range inputs {
+				if in.Email == "taken@example.com" {
+					continue
+				}
+				created = append(created, User{UserID: uuid.New(), Email: in.Email})
+			}
+			return created, nil
+		},
+		auditFn: func(context.Context, AuditRecord) error {
+			audited++
+			return nil
+		},
+	}
+	in := "firstName,lastName,email\n" +
+		"Ada,Lovelace,ada@example.com\n" +
+		"Taken,User,taken@example.com\n" +
+		"Ada,Again,ada@example.com\n" +
+		"X,Short,x@example.com\n"
+
+	for _, dryRun := range []bool{false, true} {
+		audited = 0
+		report, err := NewService(repo).Import(context.Background(), ImportCSV, strings.NewReader(in), dryRun)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var statuses []string
+		for _, row := range report.Rows {
+			statuses = append(statuses, row.Status)
+		}
+		if got := strings.Join(statuses, ","); got != "created,skipped,skipped,rejected" {
+			t.Fatalf("dryRun=%v: unexpected statuses %s", dryRun, got)
+		}
+		if report.Rows[1].Reason != ErrEmailTaken.Error() || report.Rows[2].Reason != "duplicate of row 2" {
+			t.Fatalf("dryRun=%v: unexpected skip reasons %q, %q", dryRun, report.Rows[1].Reason, report.Rows[2].Reason)
+		}
+		if dryRun && (report.Rows[0].User != nil || audited != 0) {
+			t.Fatal("dry run must not report created users or write audit records")
+		}
+		if !dryRun && (report.Rows[0].User == nil || audited != 1) {
+			t.Fatalf("expected created user and one audit record, got %+v and %d", report.Rows[0].User, audited)
+		}
+	}
+}
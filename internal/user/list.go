@@ -0,0 +1,137 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+// ListOptions narrows, orders and paginates a user listing.
+type ListOptions struct {
+	Filter Filter
+	Sort   []SortField
+	Page   PageRequest
+}
+
+// Filter restricts a listing. Zero values mean "no restriction"; time bounds
+// are exclusive. Soft-deleted users are excluded unless IncludeDeleted is set.
+type Filter struct {
+	IncludeDeleted bool
+	Status         string
+	EmailDomain    string
+	MinAge         *int
+	MaxAge         *int
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	UpdatedAfter   *time.Time
+	UpdatedBefore  *time.Time
+}
+
+// SortField orders a listing by one exposed field, named as in the JSON
+// representation of User.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// DefaultSort lists the newest users first.
+var DefaultSort = []SortField{{Field: "createdAt", Desc: true}}
+
+// sortColumns maps sortable JSON field names to SQL expressions. Nullable
+// columns are coalesced so that keyset comparisons stay well defined.
+var sortColumns = map[string]string{
+	"userId":    "user_id",
+	"firstName": "first_name",
+	"lastName":  "last_name",
+	"email":     "email",
+	"phone":     "COALESCE(phone, '')",
+	"age":       "COALESCE(age, 0)",
+	"status":    "status",
+	"createdAt": "created_at",
+	"updatedAt": "updated_at",
+}
+
+// ParseSort parses a comma-separated sort expression such as
+// "-lastName,firstName". A leading "-" sorts that field descending.
+func ParseSort(s string) ([]SortField, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool)
+	fields := make([]SortField, 0, strings.Count(s, ",")+1)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		f := SortField{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if _, ok := sortColumns[f.Field]; !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidSort, f.Field)
+		}
+		if seen[f.Field] {
+			return nil, fmt.Errorf("%w: duplicate field %q", ErrInvalidSort, f.Field)
+		}
+		seen[f.Field] = true
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// formatSort renders the sort in the same syntax ParseSort accepts.
+func formatSort(fields []SortField) string {
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		if f.Desc {
+			parts[i] = "-" + f.Field
+		} else {
+			parts[i] = f.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// resolveSort returns the requested sort, falling back to DefaultSort, with
+// userId appended as a tie-breaker so every row has a unique position.
+func resolveSort(fields []SortField) []SortField {
+	if len(fields) == 0 {
+		fields = DefaultSort
+	}
+	for _, f := range fields {
+		if f.Field == "userId" {
+			return fields
+		}
+	}
+	out := make([]SortField, len(fields), len(fields)+1)
+	copy(out, fields)
+	return append(out, SortField{Field: "userId", Desc: fields[len(fields)-1].Desc})
+}
+
+// sortValue returns the value of field for u, matching the SQL expression in
+// sortColumns.
+func sortValue(u User, field string) any {
+	switch field {
+	case "userId":
+		return u.UserID
+	case "firstName":
+		return u.FirstName
+	case "lastName":
+		return u.LastName
+	case "email":
+		return u.Email
+	case "phone":
+		return u.Phone
+	case "age":
+		if u.Age == nil {
+			return 0
+		}
+		return *u.Age
+	case "status":
+		return u.Status
+	case "createdAt":
+		return u.CreatedAt
+	case "updatedAt":
+		return u.UpdatedAt
+	}
+	return nil
+}
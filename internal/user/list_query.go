@@ -0,0 +1,150 @@
+package user
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	db "go-crud/internal/db/sqlc"
+)
+
+const userColumns = "user_id, first_name, last_name, email, phone, age, status, created_at, updated_at, version, deleted_at, email_verified_at"
+
+// queryBuilder accumulates WHERE conditions and their positional arguments.
+// Only placeholders are ever interpolated from caller input; column names and
+// expressions come from sortColumns or literals in this file.
+type queryBuilder struct {
+	conds []string
+	args  []any
+}
+
+func (b *queryBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *queryBuilder) where(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+func (b *queryBuilder) whereClause() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
+
+func (b *queryBuilder) applyFilter(f Filter) {
+	if !f.IncludeDeleted {
+		b.where("deleted_at IS NULL")
+	}
+	if f.Status != "" {
+		b.where("status = " + b.arg(f.Status))
+	}
+	if f.EmailDomain != "" {
+		b.where("lower(split_part(email, '@', 2)) = lower(" + b.arg(f.EmailDomain) + ")")
+	}
+	if f.MinAge != nil {
+		b.where("age >= " + b.arg(*f.MinAge))
+	}
+	if f.MaxAge != nil {
+		b.where("age <= " + b.arg(*f.MaxAge))
+	}
+	if f.CreatedAfter != nil {
+		b.where("created_at > " + b.arg(*f.CreatedAfter))
+	}
+	if f.CreatedBefore != nil {
+		b.where("created_at < " + b.arg(*f.CreatedBefore))
+	}
+	if f.UpdatedAfter != nil {
+		b.where("updated_at > " + b.arg(*f.UpdatedAfter))
+	}
+	if f.UpdatedBefore != nil {
+		b.where("updated_at < " + b.arg(*f.UpdatedBefore))
+	}
+}
+
+// applyKeyset restricts rows to those strictly after the cursor position.
+// Mixed sort directions rule out a single row comparison, so the condition
+// is expanded to (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+func (b *queryBuilder) applyKeyset(sort []SortField, after []any) {
+	if len(after) == 0 {
+		return
+	}
+
+	branches := make([]string, 0, len(sort))
+	for i, f := range sort {
+		terms := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			terms = append(terms, sortColumns[sort[j].Field]+" = "+b.arg(after[j]))
+		}
+		op := " > "
+		if f.Desc {
+			op = " < "
+		}
+		terms = append(terms, sortColumns[f.Field]+op+b.arg(after[i]))
+		branches = append(branches, "("+strings.Join(terms, " AND ")+")")
+	}
+	b.where("(" + strings.Join(branches, " OR ") + ")")
+}
+
+func orderByClause(sort []SortField) string {
+	parts := make([]string, len(sort))
+	for i, f := range sort {
+		dir := " ASC"
+		if f.Desc {
+			dir = " DESC"
+		}
+		parts[i] = sortColumns[f.Field] + dir
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// buildListQuery renders a parameterised SELECT for one page of users. sort
+// must already be resolved so that it ends in a unique key.
+func buildListQuery(f Filter, sort []SortField, after []any, limit int) (string, []any) {
+	var b queryBuilder
+	b.applyFilter(f)
+	b.applyKeyset(sort, after)
+
+	query := "SELECT " + userColumns + " FROM users" + b.whereClause() + orderByClause(sort) + " LIMIT " + b.arg(limit)
+	return query, b.args
+}
+
+// buildExportQuery renders a parameterised SELECT of every matching user,
+// for reading through a server-side cursor.
+func buildExportQuery(f Filter, sort []SortField) (string, []any) {
+	var b queryBuilder
+	b.applyFilter(f)
+	return "SELECT " + userColumns + " FROM users" + b.whereClause() + orderByClause(sort), b.args
+}
+
+func scanUsers(rows *sql.Rows) ([]User, error) {
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u db.User
+		if err := rows.Scan(
+			&u.UserID,
+			&u.FirstName,
+			&u.LastName,
+			&u.Email,
+			&u.Phone,
+			&u.Age,
+			&u.Status,
+			&u.CreatedAt,
+			&u.UpdatedAt,
+			&u.Version,
+			&u.DeletedAt,
+			&u.EmailVerifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, fromDBUser(u))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,79 @@
+package user
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSort(t *testing.T) {
+	got, err := ParseSort("-lastName, firstName")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []SortField{{Field: "lastName", Desc: true}, {Field: "firstName"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseSortRejectsUnknownAndDuplicateFields(t *testing.T) {
+	for _, in := range []string{"password", "-email,email", "first_name", ","} {
+		if _, err := ParseSort(in); !errors.Is(err, ErrInvalidSort) {
+			t.Fatalf("expected ErrInvalidSort for %q, got %v", in, err)
+		}
+	}
+}
+
+func TestResolveSortAppendsTieBreaker(t *testing.T) {
+	got := resolveSort([]SortField{{Field: "email"}})
+	want := []SortField{{Field: "email"}, {Field: "userId"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	got = resolveSort(nil)
+	want = []SortField{{Field: "createdAt", Desc: true}, {Field: "userId", Desc: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestBuildListQueryParameterisesFiltersAndKeyset(t *testing.T) {
+	minAge := 18
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sort := resolveSort([]SortField{{Field: "lastName", Desc: true}, {Field: "age"}})
+
+	query, args := buildListQuery(Filter{
+		Status:       StatusActive,
+		EmailDomain:  "example.com",
+		MinAge:       &minAge,
+		CreatedAfter: &after,
+	}, sort, []any{"Doe", 30, "id"}, 11)
+
+	wantQuery := "SELECT " + userColumns + " FROM users" +
+		" WHERE deleted_at IS NULL" +
+		" AND status = $1" +
+		" AND lower(split_part(email, '@', 2)) = lower($2)" +
+		" AND age >= $3" +
+		" AND created_at > $4" +
+		" AND ((last_name < $5) OR (last_name = $6 AND COALESCE(age, 0) > $7)" +
+		" OR (last_name = $8 AND COALESCE(age, 0) = $9 AND user_id > $10))" +
+		" ORDER BY last_name DESC, COALESCE(age, 0) ASC, user_id ASC LIMIT $11"
+	if query != wantQuery {
+		t.Fatalf("unexpected query:\n got: %s\nwant: %s", query, wantQuery)
+	}
+	wantArgs := []any{StatusActive, "example.com", 18, after, "Doe", "Doe", 30, "Doe", 30, "id", 11}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
+
+func TestBuildListQueryIncludeDeleted(t *testing.T) {
+	query, _ := buildListQuery(Filter{IncludeDeleted: true}, resolveSort(nil), nil, 10)
+	want := "SELECT " + userColumns + " FROM users ORDER BY created_at DESC, user_id DESC LIMIT $1"
+	if query != want {
+		t.Fatalf("unexpected query:\n got: %s\nwant: %s", query, want)
+	}
+}
@@ -1,6 +1,10 @@
 package user
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 const (
 	StatusActive   = "Active"
@@ -8,13 +12,20 @@ const (
 )
 
 type User struct {
-	UserID    uuid.UUID `json:"userId"`
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
-	Email     string    `json:"email"`
-	Phone     string    `json:"phone,omitempty"`
-	Age       *int      `json:"age,omitempty"`
-	Status    string    `json:"status"`
+	UserID    uuid.UUID  `json:"userId"`
+	FirstName string     `json:"firstName"`
+	LastName  string     `json:"lastName"`
+	Email     string     `json:"email"`
+	Phone     string     `json:"phone,omitempty"`
+	Age       *int       `json:"age,omitempty"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	Version   int64      `json:"version"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// EmailVerifiedAt is when the user proved they own Email. Changing the
+	// email clears it.
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty"`
 }
 
 type CreateUserRequest struct {
@@ -24,6 +35,9 @@ type CreateUserRequest struct {
 	Phone     string `json:"phone" validate:"omitempty,e164"`
 	Age       *int   `json:"age" validate:"omitempty,gt=0"`
 	Status    string `json:"status" validate:"omitempty,oneof=Active Inactive"`
+	// Password is optional and never returned; it must satisfy the
+	// password policy.
+	Password string `json:"password,omitempty"`
 }
 
 type UpdateUserRequest struct {
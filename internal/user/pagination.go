@@ -0,0 +1,100 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageRequest selects one page of a keyset-paginated listing. An empty Cursor
+// requests the first page.
+type PageRequest struct {
+	Limit  int
+	Cursor string
+}
+
+// Page is one page of users. NextCursor is empty when there are no more rows.
+type Page struct {
+	Users      []User
+	NextCursor string
+}
+
+// cursor is the position of the last row of a page: the row's value for each
+// sort field, tagged with the sort it was produced under.
+type cursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+func encodeCursor(sort []SortField, last User) string {
+	c := cursor{Sort: formatSort(sort), Values: make([]json.RawMessage, len(sort))}
+	for i, f := range sort {
+		c.Values[i], _ = json.Marshal(sortValue(last, f.Field))
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns the keyset values held by s. A cursor is only valid
+// for the sort it was issued under.
+func decodeCursor(s string, sort []SortField) ([]any, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != formatSort(sort) || len(c.Values) != len(sort) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]any, len(sort))
+	for i, f := range sort {
+		v, err := decodeSortValue(f.Field, c.Values[i])
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func decodeSortValue(field string, raw json.RawMessage) (any, error) {
+	switch field {
+	case "userId":
+		var v uuid.UUID
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case "age":
+		var v int
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case "createdAt", "updatedAt":
+		var v time.Time
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	default:
+		var v string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	}
+}
+
+func resolveLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return limit
+}
@@ -0,0 +1,52 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	sort := resolveSort([]SortField{{Field: "age"}, {Field: "createdAt", Desc: true}})
+	age := 30
+	last := User{
+		UserID:    uuid.New(),
+		Age:       &age,
+		CreatedAt: time.Date(2024, 5, 1, 10, 30, 0, 123456000, time.UTC),
+	}
+
+	got, err := decodeCursor(encodeCursor(sort, last), sort)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got[0] != 30 || !got[1].(time.Time).Equal(last.CreatedAt) || got[2] != last.UserID {
+		t.Fatalf("cursor mismatch: got %v", got)
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	sort := resolveSort(nil)
+	for _, in := range []string{"not base64!", "e30", "bnVsbA"} {
+		if _, err := decodeCursor(in, sort); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("expected ErrInvalidCursor for %q, got %v", in, err)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsDifferentSort(t *testing.T) {
+	c := encodeCursor(resolveSort(nil), User{UserID: uuid.New(), CreatedAt: time.Now()})
+	if _, err := decodeCursor(c, resolveSort([]SortField{{Field: "email"}})); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestResolveLimit(t *testing.T) {
+	cases := map[int]int{0: DefaultPageLimit, -1: DefaultPageLimit, 10: 10, MaxPageLimit + 1: MaxPageLimit}
+	for in, want := range cases {
+		if got := resolveLimit(in); got != want {
+			t.Fatalf("resolveLimit(%d) = %d, want %d", in, got, want)
+		}
+	}
+}
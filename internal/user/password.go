@@ -0,0 +1,191 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	"go-crud/internal/auth"
+)
+
+var (
+	ErrNoPassword        = errors.New("user has no password")
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+)
+
+// PasswordResetRule names the built-in rule that lets only principals with
+// the users:admin scope set another user's password.
+const PasswordResetRule = "password-reset-requires-admin"
+
+// ChangePasswordRequest sets a user's password. Users changing their own
+// password must confirm the current one, if they have one; admins resetting
+// someone else's need not.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword" validate:"required"`
+}
+
+// WithPasswordHasher hashes new passwords with h. Stored hashes made with
+// other parameters are replaced the next time their user signs in.
+func WithPasswordHasher(h *auth.PasswordHasher) ServiceOption {
+	return func(s *Service) {
+		s.passwords = h
+	}
+}
+
+// WithPasswordPolicy rejects new passwords that p finds too weak.
+func WithPasswordPolicy(p auth.PasswordPolicy) ServiceOption {
+	return func(s *Service) {
+		s.passwordPolicy = p
+	}
+}
+
+// SetPassword replaces a user's password and signs the user out of every
+// session. Whatever the Authorizer allows, principals need the users:admin
+// scope to set another user's password.
+func (s *Service) SetPassword(ctx context.Context, id uuid.UUID, req ChangePasswordRequest) (err error) {
+	ctx, end := startSpan(ctx, "SetPassword", attribute.String("user.id", id.String()))
+	defer end(&err)
+
+	if err := s.validate.Struct(req); err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, Operation{Action: ActionSetPassword, UserID: &id, Fields: []string{"password"}}); err != nil {
+		return err
+	}
+	p, ok := auth.PrincipalFromContext(ctx)
+	self := ok && strings.EqualFold(p.UserID, id.String())
+	if ok && !self && !p.HasScope(auth.ScopeUsersAdmin) {
+		return &ForbiddenError{Action: ActionSetPassword, Rule: PasswordResetRule}
+	}
+
+	return s.repo.WithTx(ctx, func(tx Repository) error {
+		u, err := tx.GetForUpdate(ctx, id, false)
+		if err != nil {
+			return err
+		}
+		if self {
+			if err := s.confirmPassword(ctx, tx, id, req.CurrentPassword); err != nil {
+				return err
+			}
+		}
+		hash, err := s.hashPassword(req.NewPassword, u.Email, u.FirstName, u.LastName)
+		if err != nil {
+			return err
+		}
+		if err := tx.SetPasswordHash(ctx, id, hash); err != nil {
+			return err
+		}
+		if _, err := tx.DeleteSessions(ctx, id); err != nil {
+			return err
+		}
+		return tx.RecordAudit(ctx, newAuditRecord(ctx, AuditPasswordChange, &u, u))
+	})
+}
+
+// CheckPassword implements auth.PasswordChecker for active users. Hashes
+// made with outdated parameters are upgraded on success.
+func (s *Service) CheckPassword(ctx context.Context, email, password string) (_ uuid.UUID, err error) {
+	ctx, end := startSpan(ctx, "CheckPassword")
+	defer end(&err)
+
+	u, err := s.repo.GetByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		s.wasteHash(password)
+		return uuid.Nil, fmt.Errorf("%w: unknown email", auth.ErrInvalidCredentials)
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	hash, err := s.repo.GetPasswordHash(ctx, u.UserID)
+	if errors.Is(err, ErrNoPassword) {
+		s.wasteHash(password)
+		return uuid.Nil, fmt.Errorf("%w: %w", auth.ErrInvalidCredentials, err)
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	ok, rehash, err := s.passwords.Verify(password, hash)
+	switch {
+	case err != nil:
+		return uuid.Nil, err
+	case !ok:
+		return uuid.Nil, fmt.Errorf("%w: wrong password", auth.ErrInvalidCredentials)
+	case u.Status != StatusActive:
+		return uuid.Nil, fmt.Errorf("%w: user is %s", auth.ErrInvalidCredentials, u.Status)
+	}
+
+	if rehash {
+		// A failed upgrade is retried at the next sign-in.
+		if hash, err := s.passwords.Hash(password); err != nil {
+			slog.WarnContext(ctx, "rehash password", "error", err)
+		} else if err := s.repo.SetPasswordHash(ctx, u.UserID, hash); err != nil {
+			slog.WarnContext(ctx, "rehash password", "error", err)
+		}
+	}
+	return u.UserID, nil
+}
+
+// confirmPassword checks current against the user's password. Users without
+// one may set it without confirmation.
+func (s *Service) confirmPassword(ctx context.Context, tx Repository, id uuid.UUID, current string) error {
+	hash, err := tx.GetPasswordHash(ctx, id)
+	if errors.Is(err, ErrNoPassword) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ok, _, err := s.passwords.Verify(current, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrIncorrectPassword
+	}
+	return nil
+}
+
+// hashPassword checks password against the policy, including that it does
+// not contain the user's own details, and hashes it.
+func (s *Service) hashPassword(password string, personal ...string) (string, error) {
+	if err := s.passwordPolicy.Check(password, personal...); err != nil {
+		return "", err
+	}
+	return s.passwords.Hash(password)
+}
+
+// wasteHash spends as long as verifying a real hash, so that sign-in
+// attempts for unknown users take as long as for known ones.
+func (s *Service) wasteHash(password string) {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = s.passwords.Hash("not the password of anyone")
+	})
+	_, _, _ = s.passwords.Verify(password, s.dummyHash)
+}
+
+func (h *Handler) SetPassword(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	if err := h.svc.SetPassword(r.Context(), id, req); err != nil {
+		handleRepoError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,264 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"go-crud/internal/auth"
+	"go-crud/internal/problem"
+)
+
+// testHasher keeps tests fast; its parameters are far too weak for real use.
+var testHasher = auth.NewPasswordHasher(auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1})
+
+const testPassword = "correct horse battery"
+
+// passwordRepo is a stubRepo holding one user's password hash and counting
+// revoked sessions and audit records.
+type passwordRepo struct {
+	user     User
+	hash     string
+	revoked  int
+	audited  []string
+	hashSets int
+}
+
+func (p *passwordRepo) stub() stubRepo {
+	return stubRepo{
+		lockFn: func(context.Context, uuid.UUID, bool) (User, error) { return p.user, nil },
+		emailFn: func(_ context.Context, email string) (User, error) {
+			if email != p.user.Email {
+				return User{}, ErrNotFound
+			}
+			return p.user, nil
+		},
+		getHashFn: func(context.Context, uuid.UUID) (string, error) {
+			if p.hash == "" {
+				return "", ErrNoPassword
+			}
+			return p.hash, nil
+		},
+		setHashFn: func(_ context.Context, _ uuid.UUID, hash string) error {
+			p.hash = hash
+			p.hashSets++
+			return nil
+		},
+		sessionsFn: func(context.Context, uuid.UUID) (int64, error) {
+			p.revoked++
+			return 1, nil
+		},
+		auditFn: func(_ context.Context, rec AuditRecord) error {
+			p.audited = append(p.audited, rec.Action)
+			return nil
+		},
+	}
+}
+
+func newPasswordRepo(t *testing.T, password string) *passwordRepo {
+	t.Helper()
+	p := &passwordRepo{user: User{UserID: uuid.New(), FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Status: StatusActive}}
+	if password != "" {
+		hash, err := testHasher.Hash(password)
+		if err != nil {
+			t.Fatalf("hash: %v", err)
+		}
+		p.hash = hash
+	}
+	return p
+}
+
+func TestServiceSetPasswordConfirmsOwnPassword(t *testing.T) {
+	repo := newPasswordRepo(t, testPassword)
+	svc := NewService(repo.stub(), WithPasswordHasher(testHasher))
+	ctx := auth.WithPrincipal(context.Background(), auth.SessionPrincipal(repo.user.UserID, repo.user.Email))
+
+	err := svc.SetPassword(ctx, repo.user.UserID, ChangePasswordRequest{CurrentPassword: "guess", NewPassword: "new secret phrase"})
+	if !errors.Is(err, ErrIncorrectPassword) {
+		t.Fatalf("expected ErrIncorrectPassword, got %v", err)
+	}
+	if repo.hashSets != 0 || repo.revoked != 0 {
+		t.Fatalf("expected nothing to change, got %d hash writes and %d revocations", repo.hashSets, repo.revoked)
+	}
+
+	err = svc.SetPassword(ctx, repo.user.UserID, ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: "new secret phrase"})
+	if err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	if ok, _, _ := testHasher.Verify("new secret phrase", repo.hash); !ok {
+		t.Fatal("expected the new password to be stored")
+	}
+	if repo.revoked != 1 {
+		t.Fatalf("expected sessions to be revoked once, got %d", repo.revoked)
+	}
+	if len(repo.audited) != 1 || repo.audited[0] != AuditPasswordChange {
+		t.Fatalf("expected a password change audit record, got %v", repo.audited)
+	}
+}
+
+func TestServiceSetPasswordLetsOthersReset(t *testing.T) {
+	repo := newPasswordRepo(t, testPassword)
+	svc := NewService(repo.stub(), WithPasswordHasher(testHasher))
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "jwt:root", Scopes: []string{auth.ScopeUsersAdmin}})
+
+	if err := svc.SetPassword(ctx, repo.user.UserID, ChangePasswordRequest{NewPassword: "new secret phrase"}); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	if repo.hashSets != 1 || repo.revoked != 1 {
+		t.Fatalf("expected the password to be reset and sessions revoked, got %d hash writes and %d revocations", repo.hashSets, repo.revoked)
+	}
+}
+
+func TestServiceSetPasswordRequiresAdminForOthers(t *testing.T) {
+	victim := newPasswordRepo(t, testPassword)
+	other := auth.SessionPrincipal(uuid.New(), "eve@example.com")
+	allowAll := authorizerFunc(func(context.Context, auth.Principal, Operation) error { return nil })
+
+	for _, opts := range [][]ServiceOption{nil, {WithAuthorizer(allowAll)}} {
+		svc := NewService(victim.stub(), append(opts, WithPasswordHasher(testHasher))...)
+		for _, p := range []auth.Principal{other, {Subject: "apikey:x", Scopes: []string{auth.ScopeUsersWrite}}} {
+			err := svc.SetPassword(auth.WithPrincipal(context.Background(), p), victim.user.UserID, ChangePasswordRequest{NewPassword: "new secret phrase"})
+			if !errors.Is(err, ErrForbidden) {
+				t.Fatalf("%s: expected ErrForbidden, got %v", p.Subject, err)
+			}
+			var denied *ForbiddenError
+			if opts != nil && (!errors.As(err, &denied) || denied.Rule != PasswordResetRule) {
+				t.Fatalf("%s: expected %s denial despite the policy, got %v", p.Subject, PasswordResetRule, err)
+			}
+		}
+	}
+	if victim.hashSets != 0 || victim.revoked != 0 {
+		t.Fatalf("expected nothing to change, got %d hash writes and %d revocations", victim.hashSets, victim.revoked)
+	}
+}
+
+func TestServiceSetPasswordAppliesPolicy(t *testing.T) {
+	repo := newPasswordRepo(t, "")
+	svc := NewService(repo.stub(), WithPasswordHasher(testHasher))
+
+	for _, pw := range []string{"short", "password123", "lovelace-1815-rules"} {
+		err := svc.SetPassword(context.Background(), repo.user.UserID, ChangePasswordRequest{NewPassword: pw})
+		if !errors.Is(err, auth.ErrWeakPassword) {
+			t.Fatalf("%q: expected ErrWeakPassword, got %v", pw, err)
+		}
+	}
+	if repo.hashSets != 0 {
+		t.Fatalf("expected no hash to be stored, got %d writes", repo.hashSets)
+	}
+}
+
+func TestServiceCreateHashesPassword(t *testing.T) {
+	repo := newPasswordRepo(t, "")
+	stub := repo.stub()
+	stub.createFn = func(_ context.Context, input CreateUserRequest) (User, error) {
+		return User{UserID: repo.user.UserID, Email: input.Email}, nil
+	}
+	svc := NewService(stub, WithPasswordHasher(testHasher))
+
+	input := CreateUserRequest{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Password: testPassword}
+	if _, err := svc.Create(context.Background(), input); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if ok, _, _ := testHasher.Verify(testPassword, repo.hash); !ok {
+		t.Fatalf("expected the password hash to be stored, got %q", repo.hash)
+	}
+
+	input.Password = "ada-lovelace-1815"
+	if _, err := svc.Create(context.Background(), input); !errors.Is(err, auth.ErrWeakPassword) {
+		t.Fatalf("expected ErrWeakPassword, got %v", err)
+	}
+}
+
+func TestServiceCheckPassword(t *testing.T) {
+	repo := newPasswordRepo(t, testPassword)
+	svc := NewService(repo.stub(), WithPasswordHasher(testHasher))
+
+	id, err := svc.CheckPassword(context.Background(), repo.user.Email, testPassword)
+	if err != nil || id != repo.user.UserID {
+		t.Fatalf("expected %s, got %s, %v", repo.user.UserID, id, err)
+	}
+	if repo.hashSets != 0 {
+		t.Fatal("expected a current hash to be kept")
+	}
+
+	for name, check := range map[string]func() error{
+		"wrong password": func() error {
+			_, err := svc.CheckPassword(context.Background(), repo.user.Email, "guess")
+			return err
+		},
+		"unknown email": func() error {
+			_, err := svc.CheckPassword(context.Background(), "bob@example.com", testPassword)
+			return err
+		},
+	} {
+		if err := check(); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Fatalf("%s: expected ErrInvalidCredentials, got %v", name, err)
+		}
+	}
+}
+
+func TestServiceCheckPasswordRejectsInactiveAndPasswordless(t *testing.T) {
+	inactive := newPasswordRepo(t, testPassword)
+	inactive.user.Status = StatusInactive
+	passwordless := newPasswordRepo(t, "")
+
+	for name, repo := range map[string]*passwordRepo{"inactive": inactive, "passwordless": passwordless} {
+		svc := NewService(repo.stub(), WithPasswordHasher(testHasher))
+		if _, err := svc.CheckPassword(context.Background(), repo.user.Email, testPassword); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Fatalf("%s: expected ErrInvalidCredentials, got %v", name, err)
+		}
+	}
+}
+
+func TestServiceCheckPasswordUpgradesHash(t *testing.T) {
+	repo := newPasswordRepo(t, testPassword)
+	old := repo.hash
+	stronger := auth.NewPasswordHasher(auth.Argon2Params{Memory: 128, Iterations: 1, Parallelism: 1})
+	svc := NewService(repo.stub(), WithPasswordHasher(stronger))
+
+	if _, err := svc.CheckPassword(context.Background(), repo.user.Email, testPassword); err != nil {
+		t.Fatalf("check password: %v", err)
+	}
+	if repo.hash == old {
+		t.Fatal("expected the hash to be upgraded")
+	}
+	if ok, rehash, _ := stronger.Verify(testPassword, repo.hash); !ok || rehash {
+		t.Fatalf("expected a current hash, got ok=%v rehash=%v", ok, rehash)
+	}
+}
+
+func TestSetPasswordReportsWeakPassword(t *testing.T) {
+	repo := newPasswordRepo(t, "")
+	r := chi.NewRouter()
+	NewHandler(NewService(repo.stub(), WithPasswordHasher(testHasher))).RegisterRoutes(r)
+
+	post := func(body any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/users/"+repo.user.UserID.String()+"/password", bytes.NewReader(b)))
+		return res
+	}
+
+	res := post(map[string]string{"newPassword": "short"})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", res.Code, res.Body)
+	}
+	var got problem.Problem
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Code != "weak_password" {
+		t.Fatalf("unexpected problem: %+v", got)
+	}
+
+	if res := post(map[string]string{"newPassword": "new secret phrase"}); res.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", res.Code, res.Body)
+	}
+}
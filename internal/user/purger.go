@@ -0,0 +1,90 @@
+package user
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go-crud/internal/auth"
+)
+
+// Purger periodically hard-deletes users that have been soft-deleted for
+// longer than the retention period, along with other expired records.
+type Purger struct {
+	svc       *Service
+	retention time.Duration
+	interval  time.Duration
+	keys      IdempotencyStore
+	sessions  auth.SessionStore
+}
+
+type PurgerOption func(*Purger)
+
+// WithExpiredIdempotencyKeys makes the purger also remove expired keys from
+// store.
+func WithExpiredIdempotencyKeys(store IdempotencyStore) PurgerOption {
+	return func(p *Purger) {
+		p.keys = store
+	}
+}
+
+// WithExpiredSessions makes the purger also remove expired sessions from
+// store.
+func WithExpiredSessions(store auth.SessionStore) PurgerOption {
+	return func(p *Purger) {
+		p.sessions = store
+	}
+}
+
+func NewPurger(svc *Service, retention, interval time.Duration, opts ...PurgerOption) *Purger {
+	p := &Purger{svc: svc, retention: retention, interval: interval}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Run purges once immediately and then every interval until ctx is done.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) purge(ctx context.Context) {
+	n, err := p.svc.PurgeDeleted(ctx, p.retention)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "purge deleted users", "error", err)
+		}
+	} else if n > 0 {
+		slog.InfoContext(ctx, "purged deleted users", "count", n, "retention", p.retention.String())
+	}
+
+	purgeExpired(ctx, "email verification tokens", p.svc.PurgeEmailVerifications)
+	if p.keys != nil {
+		purgeExpired(ctx, "idempotency keys", p.keys.PurgeExpired)
+	}
+	if p.sessions != nil {
+		purgeExpired(ctx, "sessions", p.sessions.PurgeExpired)
+	}
+}
+
+func purgeExpired(ctx context.Context, what string, purge func(context.Context) (int64, error)) {
+	n, err := purge(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "purge expired "+what, "error", err)
+		}
+	} else if n > 0 {
+		slog.InfoContext(ctx, "purged expired "+what, "count", n)
+	}
+}
@@ -3,29 +3,101 @@ package user
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
+	"time"
 
 	db "go-crud/internal/db/sqlc"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
-var ErrNotFound = errors.New("user not found")
+var (
+	ErrNotFound        = errors.New("user not found")
+	ErrVersionMismatch = errors.New("user has been modified since it was read")
+	ErrNotDeleted      = errors.New("user is not deleted")
+)
 
 type Repository interface {
 	Create(ctx context.Context, input CreateUserRequest) (User, error)
 	GetByID(ctx context.Context, id uuid.UUID) (User, error)
-	List(ctx context.Context) ([]User, error)
-	Update(ctx context.Context, id uuid.UUID, input UpdateUserRequest) (User, error)
-	Delete(ctx context.Context, id uuid.UUID) error
+	List(ctx context.Context, opts ListOptions) (Page, error)
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+	// Export calls fn for every user matching f, in sort order, reading
+	// through a server-side cursor so that memory use does not grow with
+	// the result. It stops at the first error from fn or ctx.
+	Export(ctx context.Context, f Filter, sort []SortField, fn func(User) error) error
+	// Update and Delete fail with ErrVersionMismatch unless expectedVersion
+	// is zero or equal to the stored version.
+	Update(ctx context.Context, id uuid.UUID, input UpdateUserRequest, expectedVersion int64) (User, error)
+	Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) error
+	Restore(ctx context.Context, id uuid.UUID) (User, error)
+	// BulkCreate inserts users in bulk, skipping inputs whose email belongs
+	// to an existing user, and returns the users it created. Emails must be
+	// unique within inputs.
+	BulkCreate(ctx context.Context, inputs []CreateUserRequest) ([]User, error)
+	// PurgeDeleted permanently removes users soft-deleted before the given
+	// time and reports how many were removed.
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+
+	// GetByEmail returns the user, not deleted, with the given email.
+	GetByEmail(ctx context.Context, email string) (User, error)
+	// GetPasswordHash fails with ErrNoPassword if the user has not set a
+	// password.
+	GetPasswordHash(ctx context.Context, id uuid.UUID) (string, error)
+	SetPasswordHash(ctx context.Context, id uuid.UUID, hash string) error
+	// DeleteSessions signs a user out of every session and reports how many
+	// there were.
+	DeleteSessions(ctx context.Context, id uuid.UUID) (int64, error)
+
+	// ReplaceEmailVerification stores v as the user's only outstanding
+	// verification token.
+	ReplaceEmailVerification(ctx context.Context, v EmailVerification) error
+	// ConsumeEmailVerification removes and returns the verification with
+	// the given token hash, failing with ErrInvalidVerificationToken if
+	// there is none.
+	ConsumeEmailVerification(ctx context.Context, tokenHash []byte) (EmailVerification, error)
+	// MarkEmailVerified records that the user owns email, failing with
+	// ErrNotFound unless it is still the user's email.
+	MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) (User, error)
+	// PurgeEmailVerifications removes expired verification tokens and
+	// reports how many were removed.
+	PurgeEmailVerifications(ctx context.Context) (int64, error)
+
+	// GetForUpdate reads a user and, inside WithTx, locks it until the
+	// transaction ends.
+	GetForUpdate(ctx context.Context, id uuid.UUID, includeDeleted bool) (User, error)
+	RecordAudit(ctx context.Context, rec AuditRecord) error
+	ListAudit(ctx context.Context, q AuditQuery) (AuditPage, error)
+
+	// WithTx runs fn with a Repository whose calls share one transaction,
+	// committed only if fn returns nil. Nested calls join the outer
+	// transaction.
+	WithTx(ctx context.Context, fn func(tx Repository) error) error
+
+	// RunBatch calls fn for items 0..n-1 in order within one transaction.
+	// Each item runs under its own savepoint, so a failed item leaves the
+	// others intact; if atomic is set and any item fails, all items are
+	// rolled back. It returns the error of each item, or an error if the
+	// batch itself could not run.
+	RunBatch(ctx context.Context, n int, atomic bool, fn func(tx Repository, i int) error) ([]error, error)
 }
 
 type PostgresRepository struct {
-	q *db.Queries
+	conn *sql.DB
+	// txConn is the connection tx runs on, used for driver-level
+	// operations such as COPY.
+	txConn *sql.Conn
+	tx     *sql.Tx
+	q      *db.Queries
 }
 
-func NewPostgresRepository(q *db.Queries) *PostgresRepository {
-	return &PostgresRepository{q: q}
+func NewPostgresRepository(conn *sql.DB) *PostgresRepository {
+	return &PostgresRepository{conn: conn, q: db.New(conn)}
 }
 
 func (r *PostgresRepository) Create(ctx context.Context, input CreateUserRequest) (User, error) {
@@ -38,7 +110,7 @@ func (r *PostgresRepository) Create(ctx context.Context, input CreateUserRequest
 		Status:    resolveStatus(input.Status),
 	})
 	if err != nil {
-		return User{}, err
+		return User{}, translateError(err)
 	}
 	return fromDBUser(row), nil
 }
@@ -54,25 +126,437 @@ func (r *PostgresRepository) GetByID(ctx context.Context, id uuid.UUID) (User, e
 	return fromDBUser(row), nil
 }
 
-func (r *PostgresRepository) List(ctx context.Context) ([]User, error) {
-	rows, err := r.q.ListUsers(ctx)
+func (r *PostgresRepository) List(ctx context.Context, opts ListOptions) (Page, error) {
+	limit := resolveLimit(opts.Page.Limit)
+	sort := resolveSort(opts.Sort)
+
+	var after []any
+	if opts.Page.Cursor != "" {
+		values, err := decodeCursor(opts.Page.Cursor, sort)
+		if err != nil {
+			return Page{}, err
+		}
+		after = values
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	query, args := buildListQuery(opts.Filter, sort, after, limit+1)
+	rows, err := r.dbtx().QueryContext(ctx, query, args...)
+	if err != nil {
+		return Page{}, err
+	}
+	users, err := scanUsers(rows)
+	if err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.NextCursor = encodeCursor(sort, page.Users[limit-1])
+	}
+	if page.Users == nil {
+		page.Users = []User{}
+	}
+	return page, nil
+}
+
+func (r *PostgresRepository) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	rows, err := r.q.SearchUsers(ctx, db.SearchUsersParams{
+		Query:        query,
+		EmailPattern: containsPattern(query),
+		ResultLimit:  int32(resolveSearchLimit(limit)),
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	users := make([]User, 0, len(rows))
+	results := make([]SearchResult, 0, len(rows))
 	for _, row := range rows {
-		users = append(users, fromDBUser(row))
+		results = append(results, SearchResult{
+			User: fromDBUser(db.User{
+				UserID:          row.UserID,
+				FirstName:       row.FirstName,
+				LastName:        row.LastName,
+				Email:           row.Email,
+				Phone:           row.Phone,
+				Age:             row.Age,
+				Status:          row.Status,
+				CreatedAt:       row.CreatedAt,
+				UpdatedAt:       row.UpdatedAt,
+				Version:         row.Version,
+				DeletedAt:       row.DeletedAt,
+				EmailVerifiedAt: row.EmailVerifiedAt,
+			}),
+			MatchedField: bestMatch(row.FirstNameScore, row.LastNameScore, row.EmailScore),
+			Score:        float64(row.TextRank + max(row.FirstNameScore, row.LastNameScore, row.EmailScore)),
+		})
+	}
+	return results, nil
+}
+
+// exportFetchSize is the number of rows fetched from the export cursor per
+// round trip.
+const exportFetchSize = 1000
+
+func (r *PostgresRepository) Export(ctx context.Context, f Filter, sort []SortField, fn func(User) error) error {
+	query, args := buildExportQuery(f, resolveSort(sort))
+
+	tx, err := r.conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DECLARE users_export NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return err
+	}
+	for {
+		rows, err := tx.QueryContext(ctx, "FETCH FORWARD "+strconv.Itoa(exportFetchSize)+" FROM users_export")
+		if err != nil {
+			return err
+		}
+		users, err := scanUsers(rows)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		if len(users) < exportFetchSize {
+			return tx.Commit()
+		}
 	}
-	return users, nil
 }
 
-func (r *PostgresRepository) Update(ctx context.Context, id uuid.UUID, input UpdateUserRequest) (User, error) {
-	existing, err := r.GetByID(ctx, id)
+// Update merges input into the stored row. The read, merge and write run in
+// one transaction holding a row lock, so concurrent patches to different
+// fields cannot overwrite each other.
+func (r *PostgresRepository) Update(ctx context.Context, id uuid.UUID, input UpdateUserRequest, expectedVersion int64) (User, error) {
+	var updated User
+	err := r.withTx(ctx, func(tx *PostgresRepository) error {
+		row, err := lockForWrite(ctx, tx.q, id, expectedVersion)
+		if err != nil {
+			return err
+		}
+
+		row, err = tx.q.UpdateUser(ctx, mergeUpdate(fromDBUser(row), input))
+		if err != nil {
+			return translateError(err)
+		}
+		updated = fromDBUser(row)
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
+	return updated, nil
+}
+
+// Delete soft-deletes the user; it stays restorable until purged.
+func (r *PostgresRepository) Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) error {
+	return r.withTx(ctx, func(tx *PostgresRepository) error {
+		if _, err := lockForWrite(ctx, tx.q, id, expectedVersion); err != nil {
+			return err
+		}
+		return tx.q.SoftDeleteUser(ctx, id)
+	})
+}
 
+func (r *PostgresRepository) Restore(ctx context.Context, id uuid.UUID) (User, error) {
+	row, err := r.q.RestoreUser(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNotFound
+		}
+		return User{}, translateError(err)
+	}
+	return fromDBUser(row), nil
+}
+
+// importColumns are the staging table columns filled by BulkCreate.
+var importColumns = []string{"first_name", "last_name", "email", "phone", "age", "status"}
+
+// BulkCreate copies inputs into a temporary staging table with COPY, then
+// merges them into users in a single statement.
+func (r *PostgresRepository) BulkCreate(ctx context.Context, inputs []CreateUserRequest) ([]User, error) {
+	var created []User
+	err := r.withTx(ctx, func(tx *PostgresRepository) error {
+		if _, err := tx.tx.ExecContext(ctx, "CREATE TEMP TABLE users_import (LIKE users INCLUDING DEFAULTS) ON COMMIT DROP"); err != nil {
+			return err
+		}
+
+		rows := make([][]any, len(inputs))
+		for i, in := range inputs {
+			var phone, age any
+			if in.Phone != "" {
+				phone = in.Phone
+			}
+			if in.Age != nil {
+				age = int32(*in.Age)
+			}
+			rows[i] = []any{in.FirstName, in.LastName, in.Email, phone, age, resolveStatus(in.Status)}
+		}
+		err := tx.txConn.Raw(func(driverConn any) error {
+			conn := driverConn.(*stdlib.Conn).Conn()
+			_, err := conn.CopyFrom(ctx, pgx.Identifier{"users_import"}, importColumns, pgx.CopyFromRows(rows))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		cols := strings.Join(importColumns, ", ")
+		result, err := tx.tx.QueryContext(ctx,
+			"INSERT INTO users ("+cols+") SELECT "+cols+" FROM users_import"+
+				" ON CONFLICT (email) WHERE deleted_at IS NULL DO NOTHING RETURNING "+userColumns)
+		if err != nil {
+			return translateError(err)
+		}
+		created, err = scanUsers(result)
+		return translateError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (r *PostgresRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return r.q.PurgeDeletedUsers(ctx, before)
+}
+
+func (r *PostgresRepository) GetForUpdate(ctx context.Context, id uuid.UUID, includeDeleted bool) (User, error) {
+	row, err := r.q.GetUserByIDForUpdate(ctx, db.GetUserByIDForUpdateParams{UserID: id, IncludeDeleted: includeDeleted})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNotFound
+		}
+		return User{}, err
+	}
+	return fromDBUser(row), nil
+}
+
+func (r *PostgresRepository) GetByEmail(ctx context.Context, email string) (User, error) {
+	row, err := r.q.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNotFound
+		}
+		return User{}, err
+	}
+	return fromDBUser(row), nil
+}
+
+func (r *PostgresRepository) GetPasswordHash(ctx context.Context, id uuid.UUID) (string, error) {
+	hash, err := r.q.GetPasswordHash(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNoPassword
+	}
+	return hash, err
+}
+
+func (r *PostgresRepository) SetPasswordHash(ctx context.Context, id uuid.UUID, hash string) error {
+	return r.q.SetPasswordHash(ctx, db.SetPasswordHashParams{UserID: id, PasswordHash: hash})
+}
+
+func (r *PostgresRepository) DeleteSessions(ctx context.Context, id uuid.UUID) (int64, error) {
+	return r.q.DeleteUserSessions(ctx, id)
+}
+
+func (r *PostgresRepository) ReplaceEmailVerification(ctx context.Context, v EmailVerification) error {
+	return r.withTx(ctx, func(tx *PostgresRepository) error {
+		if _, err := tx.q.DeleteUserEmailVerifications(ctx, v.UserID); err != nil {
+			return err
+		}
+		return tx.q.CreateEmailVerification(ctx, db.CreateEmailVerificationParams{
+			TokenHash: v.TokenHash,
+			UserID:    v.UserID,
+			Email:     v.Email,
+			ExpiresAt: v.ExpiresAt,
+		})
+	})
+}
+
+func (r *PostgresRepository) ConsumeEmailVerification(ctx context.Context, tokenHash []byte) (EmailVerification, error) {
+	row, err := r.q.ConsumeEmailVerification(ctx, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return EmailVerification{}, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return EmailVerification{}, err
+	}
+	return EmailVerification{UserID: row.UserID, Email: row.Email, TokenHash: tokenHash, ExpiresAt: row.ExpiresAt}, nil
+}
+
+func (r *PostgresRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) (User, error) {
+	u, err := r.q.MarkEmailVerified(ctx, db.MarkEmailVerifiedParams{UserID: id, Email: email})
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return fromDBUser(u), nil
+}
+
+func (r *PostgresRepository) PurgeEmailVerifications(ctx context.Context) (int64, error) {
+	return r.q.DeleteExpiredEmailVerifications(ctx)
+}
+
+func (r *PostgresRepository) RecordAudit(ctx context.Context, rec AuditRecord) error {
+	changes, err := json.Marshal(rec.Changes)
+	if err != nil {
+		return err
+	}
+	_, err = r.q.InsertAuditRecord(ctx, db.InsertAuditRecordParams{
+		UserID:    rec.UserID,
+		Action:    rec.Action,
+		Actor:     rec.Actor,
+		RequestID: toNullString(rec.RequestID),
+		Changes:   changes,
+	})
+	return err
+}
+
+func (r *PostgresRepository) ListAudit(ctx context.Context, q AuditQuery) (AuditPage, error) {
+	limit := resolveLimit(q.Page.Limit)
+	params := db.ListAuditRecordsParams{PageLimit: int32(limit + 1)}
+	if q.UserID != nil {
+		params.UserID = uuid.NullUUID{UUID: *q.UserID, Valid: true}
+	}
+	if q.Since != nil {
+		params.Since = sql.NullTime{Time: *q.Since, Valid: true}
+	}
+	if q.Until != nil {
+		params.Until = sql.NullTime{Time: *q.Until, Valid: true}
+	}
+	if q.Page.Cursor != "" {
+		c, err := decodeAuditCursor(q.Page.Cursor)
+		if err != nil {
+			return AuditPage{}, err
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		params.CursorAuditID = sql.NullInt64{Int64: c.ID, Valid: true}
+	}
+
+	rows, err := r.q.ListAuditRecords(ctx, params)
+	if err != nil {
+		return AuditPage{}, err
+	}
+
+	page := AuditPage{Records: make([]AuditRecord, 0, len(rows))}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		page.NextCursor = encodeAuditCursor(auditCursor{CreatedAt: last.CreatedAt, ID: last.AuditID})
+	}
+	for _, row := range rows {
+		rec, err := fromDBAudit(row)
+		if err != nil {
+			return AuditPage{}, err
+		}
+		page.Records = append(page.Records, rec)
+	}
+	return page, nil
+}
+
+func (r *PostgresRepository) WithTx(ctx context.Context, fn func(tx Repository) error) error {
+	return r.withTx(ctx, func(tx *PostgresRepository) error { return fn(tx) })
+}
+
+func (r *PostgresRepository) RunBatch(ctx context.Context, n int, atomic bool, fn func(tx Repository, i int) error) ([]error, error) {
+	errs := make([]error, n)
+	err := r.withTx(ctx, func(tx *PostgresRepository) error {
+		if _, err := tx.tx.ExecContext(ctx, "SAVEPOINT batch"); err != nil {
+			return err
+		}
+
+		failed := false
+		for i := range n {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if _, err := tx.tx.ExecContext(ctx, "SAVEPOINT batch_item"); err != nil {
+				return err
+			}
+			if err := fn(tx, i); err != nil {
+				errs[i] = err
+				failed = true
+				if _, err := tx.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_item"); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_item"); err != nil {
+				return err
+			}
+		}
+
+		if atomic && failed {
+			_, err := tx.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch")
+			return err
+		}
+		_, err := tx.tx.ExecContext(ctx, "RELEASE SAVEPOINT batch")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// withTx runs fn with a copy of the repository bound to a transaction,
+// starting one unless the repository is already bound.
+func (r *PostgresRepository) withTx(ctx context.Context, fn func(tx *PostgresRepository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	conn, err := r.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&PostgresRepository{conn: r.conn, txConn: conn, tx: tx, q: r.q.WithTx(tx)}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// dbtx returns the transaction the repository is bound to, if any, for
+// queries built outside sqlc.
+func (r *PostgresRepository) dbtx() db.DBTX {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.conn
+}
+
+// lockForWrite locks the row for the rest of the transaction and checks it
+// against the caller's expected version.
+func lockForWrite(ctx context.Context, q *db.Queries, id uuid.UUID, expectedVersion int64) (db.User, error) {
+	row, err := q.GetUserByIDForUpdate(ctx, db.GetUserByIDForUpdateParams{UserID: id})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.User{}, ErrNotFound
+		}
+		return db.User{}, err
+	}
+	if expectedVersion != 0 && row.Version != expectedVersion {
+		return db.User{}, ErrVersionMismatch
+	}
+	return row, nil
+}
+
+func mergeUpdate(existing User, input UpdateUserRequest) db.UpdateUserParams {
 	firstName := existing.FirstName
 	if input.FirstName != nil {
 		firstName = *input.FirstName
@@ -104,32 +588,15 @@ func (r *PostgresRepository) Update(ctx context.Context, id uuid.UUID, input Upd
 		status = *input.Status
 	}
 
-	row, err := r.q.UpdateUser(ctx, db.UpdateUserParams{
-		UserID:    id,
+	return db.UpdateUserParams{
+		UserID:    existing.UserID,
 		FirstName: firstName,
 		LastName:  lastName,
 		Email:     email,
 		Phone:     toNullString(phone),
 		Age:       toNullInt32(age),
 		Status:    resolveStatus(status),
-	})
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, ErrNotFound
-		}
-		return User{}, err
 	}
-	return fromDBUser(row), nil
-}
-
-func (r *PostgresRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	if _, err := r.q.GetUserByID(ctx, id); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrNotFound
-		}
-		return err
-	}
-	return r.q.DeleteUser(ctx, id)
 }
 
 func fromDBUser(u db.User) User {
@@ -144,15 +611,47 @@ func fromDBUser(u db.User) User {
 		phone = u.Phone.String
 	}
 
+	var deletedAt *time.Time
+	if u.DeletedAt.Valid {
+		v := u.DeletedAt.Time
+		deletedAt = &v
+	}
+
+	var emailVerifiedAt *time.Time
+	if u.EmailVerifiedAt.Valid {
+		v := u.EmailVerifiedAt.Time
+		emailVerifiedAt = &v
+	}
+
 	return User{
-		UserID:    u.UserID,
-		FirstName: u.FirstName,
-		LastName:  u.LastName,
-		Email:     u.Email,
-		Phone:     phone,
-		Age:       age,
-		Status:    u.Status,
+		UserID:          u.UserID,
+		FirstName:       u.FirstName,
+		LastName:        u.LastName,
+		Email:           u.Email,
+		Phone:           phone,
+		Age:             age,
+		Status:          u.Status,
+		CreatedAt:       u.CreatedAt,
+		UpdatedAt:       u.UpdatedAt,
+		Version:         u.Version,
+		DeletedAt:       deletedAt,
+		EmailVerifiedAt: emailVerifiedAt,
+	}
+}
+
+func fromDBAudit(a db.UserAudit) (AuditRecord, error) {
+	rec := AuditRecord{
+		ID:        a.AuditID,
+		UserID:    a.UserID,
+		Action:    a.Action,
+		Actor:     a.Actor,
+		RequestID: a.RequestID.String,
+		CreatedAt: a.CreatedAt,
+	}
+	if err := json.Unmarshal(a.Changes, &rec.Changes); err != nil {
+		return AuditRecord{}, err
 	}
+	return rec, nil
 }
 
 func toNullString(v string) sql.NullString {
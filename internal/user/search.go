@@ -0,0 +1,51 @@
+package user
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+var ErrEmptySearchQuery = errors.New("search query must not be empty")
+
+// SearchResult is one ranked hit of a user search. MatchedField names the
+// JSON field that matched the query most closely.
+type SearchResult struct {
+	User         User    `json:"user"`
+	MatchedField string  `json:"matchedField"`
+	Score        float64 `json:"score"`
+}
+
+// bestMatch picks the field with the highest similarity score. Ties go to
+// the earlier field, so names win over email.
+func bestMatch(firstName, lastName, email float32) string {
+	field, best := "firstName", firstName
+	if lastName > best {
+		field, best = "lastName", lastName
+	}
+	if email > best {
+		field = "email"
+	}
+	return field
+}
+
+// containsPattern builds an ILIKE pattern matching q anywhere, with LIKE
+// wildcards in q escaped.
+func containsPattern(q string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(q) + "%"
+}
+
+func resolveSearchLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		return MaxSearchLimit
+	}
+	return limit
+}
@@ -0,0 +1,26 @@
+package user
+
+import "testing"
+
+func TestBestMatch(t *testing.T) {
+	cases := []struct {
+		first, last, email float32
+		want               string
+	}{
+		{0.9, 0.2, 0.1, "firstName"},
+		{0.2, 0.8, 0.1, "lastName"},
+		{0.2, 0.3, 0.7, "email"},
+		{0.5, 0.5, 0.5, "firstName"},
+	}
+	for _, c := range cases {
+		if got := bestMatch(c.first, c.last, c.email); got != c.want {
+			t.Fatalf("bestMatch(%v, %v, %v) = %q, want %q", c.first, c.last, c.email, got, c.want)
+		}
+	}
+}
+
+func TestContainsPatternEscapesWildcards(t *testing.T) {
+	if got, want := containsPattern(`100%_a\b`), `%100\%\_a\\b%`; got != want {
+		t.Fatalf("containsPattern = %q, want %q", got, want)
+	}
+}
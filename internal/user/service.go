@@ -3,45 +3,297 @@ package user
 import (
 	"context"
 	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	"go-crud/internal/auth"
+	"go-crud/internal/mail"
 )
 
+var ErrNoUpdates = errors.New("at least one field must be provided")
+
 type Service struct {
-	repo     Repository
-	validate *validator.Validate
+	repo       Repository
+	validate   *validator.Validate
+	authorizer Authorizer
+
+	passwords      *auth.PasswordHasher
+	passwordPolicy auth.PasswordPolicy
+	dummyHashOnce  sync.Once
+	dummyHash      string
+
+	mailer     mail.Mailer
+	verifyLink string
+	verifyTTL  time.Duration
+}
+
+func NewService(repo Repository, opts ...ServiceOption) *Service {
+	s := &Service{
+		repo:           repo,
+		validate:       newValidator(),
+		passwords:      auth.NewPasswordHasher(auth.DefaultArgon2Params),
+		passwordPolicy: auth.DefaultPasswordPolicy,
+		authorizer:     SessionAuthorizer{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo, validate: validator.New()}
+// newValidator reports fields by their JSON names so that validation errors
+// match what clients sent.
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
 }
 
-func (s *Service) Create(ctx context.Context, input CreateUserRequest) (User, error) {
-	if err := s.validate.Struct(input); err != nil {
+func (s *Service) Create(ctx context.Context, input CreateUserRequest) (_ User, err error) {
+	ctx, end := startSpan(ctx, "Create")
+	defer end(&err)
+
+	var (
+		created User
+		out     outbox
+	)
+	err = s.repo.WithTx(ctx, func(tx Repository) error {
+		u, err := s.create(ctx, tx, input, &out)
+		created = u
+		return err
+	})
+	if err != nil {
 		return User{}, err
 	}
-	return s.repo.Create(ctx, input)
+	s.send(ctx, out)
+	return created, nil
 }
 
-func (s *Service) GetByID(ctx context.Context, id uuid.UUID) (User, error) {
+func (s *Service) GetByID(ctx context.Context, id uuid.UUID) (_ User, err error) {
+	ctx, end := startSpan(ctx, "GetByID", attribute.String("user.id", id.String()))
+	defer end(&err)
+
+	if err := s.authorize(ctx, Operation{Action: ActionRead, UserID: &id}); err != nil {
+		return User{}, err
+	}
 	return s.repo.GetByID(ctx, id)
 }
 
-func (s *Service) List(ctx context.Context) ([]User, error) {
-	return s.repo.List(ctx)
+func (s *Service) List(ctx context.Context, opts ListOptions) (_ Page, err error) {
+	ctx, end := startSpan(ctx, "List")
+	defer end(&err)
+
+	if err := s.authorize(ctx, Operation{Action: ActionList, IncludeDeleted: opts.Filter.IncludeDeleted}); err != nil {
+		return Page{}, err
+	}
+	return s.repo.List(ctx, opts)
+}
+
+func (s *Service) Search(ctx context.Context, query string, limit int) (_ []SearchResult, err error) {
+	ctx, end := startSpan(ctx, "Search")
+	defer end(&err)
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, ErrEmptySearchQuery
+	}
+	if err := s.authorize(ctx, Operation{Action: ActionSearch}); err != nil {
+		return nil, err
+	}
+	return s.repo.Search(ctx, query, limit)
+}
+
+// Export writes the users selected by opts to w in the requested format.
+// Output is buffered, so an export that fails early writes nothing to w.
+func (s *Service) Export(ctx context.Context, w io.Writer, opts ExportOptions) (err error) {
+	ctx, end := startSpan(ctx, "Export", attribute.String("export.format", opts.Format))
+	defer end(&err)
+
+	if err := s.authorize(ctx, Operation{Action: ActionExport, IncludeDeleted: opts.Filter.IncludeDeleted}); err != nil {
+		return err
+	}
+	out, err := newExportWriter(w, opts)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Export(ctx, opts.Filter, opts.Sort, out.Write); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// Update applies a partial update. A non-zero expectedVersion makes the
+// update conditional on the stored version, as with HTTP If-Match.
+func (s *Service) Update(ctx context.Context, id uuid.UUID, input UpdateUserRequest, expectedVersion int64) (_ User, err error) {
+	ctx, end := startSpan(ctx, "Update", attribute.String("user.id", id.String()))
+	defer end(&err)
+
+	var (
+		updated User
+		out     outbox
+	)
+	err = s.repo.WithTx(ctx, func(tx Repository) error {
+		u, err := s.update(ctx, tx, id, input, expectedVersion, &out)
+		updated = u
+		return err
+	})
+	if err != nil {
+		return User{}, err
+	}
+	s.send(ctx, out)
+	return updated, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) (err error) {
+	ctx, end := startSpan(ctx, "Delete", attribute.String("user.id", id.String()))
+	defer end(&err)
+
+	return s.repo.WithTx(ctx, func(tx Repository) error {
+		return s.delete(ctx, tx, id, expectedVersion)
+	})
+}
+
+func (s *Service) Restore(ctx context.Context, id uuid.UUID) (_ User, err error) {
+	ctx, end := startSpan(ctx, "Restore", attribute.String("user.id", id.String()))
+	defer end(&err)
+
+	if err := s.authorize(ctx, Operation{Action: ActionRestore, UserID: &id}); err != nil {
+		return User{}, err
+	}
+	var restored User
+	err = s.repo.WithTx(ctx, func(tx Repository) error {
+		before, err := tx.GetForUpdate(ctx, id, true)
+		if err != nil {
+			return err
+		}
+		if before.DeletedAt == nil {
+			return ErrNotDeleted
+		}
+		u, err := tx.Restore(ctx, id)
+		if err != nil {
+			return err
+		}
+		restored = u
+		return tx.RecordAudit(ctx, newAuditRecord(ctx, AuditRestore, &before, u))
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return restored, nil
+}
+
+func (s *Service) ListAudit(ctx context.Context, q AuditQuery) (_ AuditPage, err error) {
+	ctx, end := startSpan(ctx, "ListAudit")
+	defer end(&err)
+
+	if err := s.authorize(ctx, Operation{Action: ActionAudit, UserID: q.UserID}); err != nil {
+		return AuditPage{}, err
+	}
+	return s.repo.ListAudit(ctx, q)
+}
+
+// PurgeDeleted permanently removes users that have been soft-deleted for
+// longer than retention.
+func (s *Service) PurgeDeleted(ctx context.Context, retention time.Duration) (_ int64, err error) {
+	ctx, end := startSpan(ctx, "PurgeDeleted")
+	defer end(&err)
+
+	return s.repo.PurgeDeleted(ctx, time.Now().Add(-retention))
 }
 
-func (s *Service) Update(ctx context.Context, id uuid.UUID, input UpdateUserRequest) (User, error) {
+// create, update and delete authorize and perform one audited mutation using
+// tx, which must be bound to a transaction. Verification emails are queued in
+// out, to be sent once the transaction commits.
+func (s *Service) create(ctx context.Context, tx Repository, input CreateUserRequest, out *outbox) (User, error) {
+	if err := s.validate.Struct(input); err != nil {
+		return User{}, err
+	}
+	if err := s.authorize(ctx, createOperation(input)); err != nil {
+		return User{}, err
+	}
+	var hash string
+	if input.Password != "" {
+		var err error
+		if hash, err = s.hashPassword(input.Password, input.Email, input.FirstName, input.LastName); err != nil {
+			return User{}, err
+		}
+	}
+
+	u, err := tx.Create(ctx, input)
+	if err != nil {
+		return User{}, err
+	}
+	if hash != "" {
+		if err := tx.SetPasswordHash(ctx, u.UserID, hash); err != nil {
+			return User{}, err
+		}
+	}
+	if err := tx.RecordAudit(ctx, newAuditRecord(ctx, AuditCreate, nil, u)); err != nil {
+		return User{}, err
+	}
+	if err := s.requestVerification(ctx, tx, u, out); err != nil {
+		return User{}, err
+	}
+	return u, nil
+}
+
+func (s *Service) update(ctx context.Context, tx Repository, id uuid.UUID, input UpdateUserRequest, expectedVersion int64, out *outbox) (User, error) {
 	if err := s.validate.Struct(input); err != nil {
 		return User{}, err
 	}
 	if !input.HasUpdates() {
-		return User{}, errors.New("at least one field must be provided")
+		return User{}, ErrNoUpdates
+	}
+	if err := s.authorize(ctx, updateOperation(id, input)); err != nil {
+		return User{}, err
+	}
+
+	before, err := tx.GetForUpdate(ctx, id, false)
+	if err != nil {
+		return User{}, err
 	}
-	return s.repo.Update(ctx, id, input)
+	u, err := tx.Update(ctx, id, input, expectedVersion)
+	if err != nil {
+		return User{}, err
+	}
+	if err := tx.RecordAudit(ctx, newAuditRecord(ctx, AuditUpdate, &before, u)); err != nil {
+		return User{}, err
+	}
+	if u.Email != before.Email {
+		if err := s.requestVerification(ctx, tx, u, out); err != nil {
+			return User{}, err
+		}
+	}
+	return u, nil
 }
 
-func (s *Service) Delete(ctx context.Context, id uuid.UUID) error {
-	return s.repo.Delete(ctx, id)
+func (s *Service) delete(ctx context.Context, tx Repository, id uuid.UUID, expectedVersion int64) error {
+	if err := s.authorize(ctx, Operation{Action: ActionDelete, UserID: &id}); err != nil {
+		return err
+	}
+	before, err := tx.GetForUpdate(ctx, id, false)
+	if err != nil {
+		return err
+	}
+	if err := tx.Delete(ctx, id, expectedVersion); err != nil {
+		return err
+	}
+	after, err := tx.GetForUpdate(ctx, id, true)
+	if err != nil {
+		return err
+	}
+	return tx.RecordAudit(ctx, newAuditRecord(ctx, AuditDelete, &before, after))
 }
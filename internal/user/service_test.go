@@ -2,17 +2,36 @@ package user
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type stubRepo struct {
-	createFn func(context.Context, CreateUserRequest) (User, error)
-	getFn    func(context.Context, uuid.UUID) (User, error)
-	listFn   func(context.Context) ([]User, error)
-	updateFn func(context.Context, uuid.UUID, UpdateUserRequest) (User, error)
-	deleteFn func(context.Context, uuid.UUID) error
+	createFn  func(context.Context, CreateUserRequest) (User, error)
+	getFn     func(context.Context, uuid.UUID) (User, error)
+	listFn    func(context.Context, ListOptions) (Page, error)
+	searchFn  func(context.Context, string, int) ([]SearchResult, error)
+	exportFn  func(context.Context, Filter, []SortField, func(User) error) error
+	updateFn  func(context.Context, uuid.UUID, UpdateUserRequest, int64) (User, error)
+	deleteFn  func(context.Context, uuid.UUID, int64) error
+	restoreFn func(context.Context, uuid.UUID) (User, error)
+	bulkFn    func(context.Context, []CreateUserRequest) ([]User, error)
+	purgeFn   func(context.Context, time.Time) (int64, error)
+	lockFn    func(context.Context, uuid.UUID, bool) (User, error)
+	auditFn   func(context.Context, AuditRecord) error
+	listAudit func(context.Context, AuditQuery) (AuditPage, error)
+
+	emailFn    func(context.Context, string) (User, error)
+	getHashFn  func(context.Context, uuid.UUID) (string, error)
+	setHashFn  func(context.Context, uuid.UUID, string) error
+	sessionsFn func(context.Context, uuid.UUID) (int64, error)
+
+	replaceVerifyFn func(context.Context, EmailVerification) error
+	consumeVerifyFn func(context.Context, []byte) (EmailVerification, error)
+	markVerifiedFn  func(context.Context, uuid.UUID, string) (User, error)
 }
 
 func (s stubRepo) Create(ctx context.Context, input CreateUserRequest) (User, error) {
@@ -29,27 +48,149 @@ func (s stubRepo) GetByID(ctx context.Context, id uuid.UUID) (User, error) {
 	return User{}, nil
 }
 
-func (s stubRepo) List(ctx context.Context) ([]User, error) {
+func (s stubRepo) List(ctx context.Context, opts ListOptions) (Page, error) {
 	if s.listFn != nil {
-		return s.listFn(ctx)
+		return s.listFn(ctx, opts)
+	}
+	return Page{}, nil
+}
+
+func (s stubRepo) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	if s.searchFn != nil {
+		return s.searchFn(ctx, query, limit)
 	}
 	return nil, nil
 }
 
-func (s stubRepo) Update(ctx context.Context, id uuid.UUID, input UpdateUserRequest) (User, error) {
+func (s stubRepo) Export(ctx context.Context, f Filter, sort []SortField, fn func(User) error) error {
+	if s.exportFn != nil {
+		return s.exportFn(ctx, f, sort, fn)
+	}
+	return nil
+}
+
+func (s stubRepo) Update(ctx context.Context, id uuid.UUID, input UpdateUserRequest, expectedVersion int64) (User, error) {
 	if s.updateFn != nil {
-		return s.updateFn(ctx, id, input)
+		return s.updateFn(ctx, id, input, expectedVersion)
 	}
 	return User{}, nil
 }
 
-func (s stubRepo) Delete(ctx context.Context, id uuid.UUID) error {
+func (s stubRepo) Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) error {
 	if s.deleteFn != nil {
-		return s.deleteFn(ctx, id)
+		return s.deleteFn(ctx, id, expectedVersion)
 	}
 	return nil
 }
 
+func (s stubRepo) Restore(ctx context.Context, id uuid.UUID) (User, error) {
+	if s.restoreFn != nil {
+		return s.restoreFn(ctx, id)
+	}
+	return User{}, nil
+}
+
+func (s stubRepo) BulkCreate(ctx context.Context, inputs []CreateUserRequest) ([]User, error) {
+	if s.bulkFn != nil {
+		return s.bulkFn(ctx, inputs)
+	}
+	return nil, nil
+}
+
+func (s stubRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	if s.purgeFn != nil {
+		return s.purgeFn(ctx, before)
+	}
+	return 0, nil
+}
+
+func (s stubRepo) GetByEmail(ctx context.Context, email string) (User, error) {
+	if s.emailFn != nil {
+		return s.emailFn(ctx, email)
+	}
+	return User{}, ErrNotFound
+}
+
+func (s stubRepo) GetPasswordHash(ctx context.Context, id uuid.UUID) (string, error) {
+	if s.getHashFn != nil {
+		return s.getHashFn(ctx, id)
+	}
+	return "", ErrNoPassword
+}
+
+func (s stubRepo) SetPasswordHash(ctx context.Context, id uuid.UUID, hash string) error {
+	if s.setHashFn != nil {
+		return s.setHashFn(ctx, id, hash)
+	}
+	return nil
+}
+
+func (s stubRepo) DeleteSessions(ctx context.Context, id uuid.UUID) (int64, error) {
+	if s.sessionsFn != nil {
+		return s.sessionsFn(ctx, id)
+	}
+	return 0, nil
+}
+
+func (s stubRepo) ReplaceEmailVerification(ctx context.Context, v EmailVerification) error {
+	if s.replaceVerifyFn != nil {
+		return s.replaceVerifyFn(ctx, v)
+	}
+	return nil
+}
+
+func (s stubRepo) ConsumeEmailVerification(ctx context.Context, tokenHash []byte) (EmailVerification, error) {
+	if s.consumeVerifyFn != nil {
+		return s.consumeVerifyFn(ctx, tokenHash)
+	}
+	return EmailVerification{}, ErrInvalidVerificationToken
+}
+
+func (s stubRepo) MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) (User, error) {
+	if s.markVerifiedFn != nil {
+		return s.markVerifiedFn(ctx, id, email)
+	}
+	return User{UserID: id, Email: email}, nil
+}
+
+func (s stubRepo) PurgeEmailVerifications(context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (s stubRepo) GetForUpdate(ctx context.Context, id uuid.UUID, includeDeleted bool) (User, error) {
+	if s.lockFn != nil {
+		return s.lockFn(ctx, id, includeDeleted)
+	}
+	return User{UserID: id}, nil
+}
+
+func (s stubRepo) RecordAudit(ctx context.Context, rec AuditRecord) error {
+	if s.auditFn != nil {
+		return s.auditFn(ctx, rec)
+	}
+	return nil
+}
+
+func (s stubRepo) ListAudit(ctx context.Context, q AuditQuery) (AuditPage, error) {
+	if s.listAudit != nil {
+		return s.listAudit(ctx, q)
+	}
+	return AuditPage{}, nil
+}
+
+func (s stubRepo) WithTx(_ context.Context, fn func(tx Repository) error) error {
+	return fn(s)
+}
+
+// RunBatch runs every item but cannot roll anything back.
+func (s stubRepo) RunBatch(_ context.Context, n int, _ bool, fn func(tx Repository, i int) error) ([]error, error) {
+	errs := make([]error, n)
+	for i := range n {
+		errs[i] = fn(s, i)
+	}
+	return errs, nil
+}
+
 func TestServiceCreateRejectsInvalidPhone(t *testing.T) {
 	svc := NewService(stubRepo{})
 
@@ -67,7 +208,7 @@ func TestServiceCreateRejectsInvalidPhone(t *testing.T) {
 func TestServiceUpdateRequiresAtLeastOneField(t *testing.T) {
 	svc := NewService(stubRepo{})
 
-	_, err := svc.Update(context.Background(), uuid.New(), UpdateUserRequest{})
+	_, err := svc.Update(context.Background(), uuid.New(), UpdateUserRequest{}, 0)
 	if err == nil {
 		t.Fatal("expected error for empty patch payload")
 	}
@@ -78,7 +219,7 @@ func TestServiceUpdateCallsRepositoryForValidPatch(t *testing.T) {
 	firstName := "Jane"
 	id := uuid.New()
 	svc := NewService(stubRepo{
-		updateFn: func(_ context.Context, gotID uuid.UUID, input UpdateUserRequest) (User, error) {
+		updateFn: func(_ context.Context, gotID uuid.UUID, input UpdateUserRequest, _ int64) (User, error) {
 			called = true
 			if gotID != id {
 				t.Fatalf("unexpected id: %v", gotID)
@@ -90,7 +231,7 @@ func TestServiceUpdateCallsRepositoryForValidPatch(t *testing.T) {
 		},
 	})
 
-	_, err := svc.Update(context.Background(), id, UpdateUserRequest{FirstName: &firstName})
+	_, err := svc.Update(context.Background(), id, UpdateUserRequest{FirstName: &firstName}, 0)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -98,3 +239,114 @@ func TestServiceUpdateCallsRepositoryForValidPatch(t *testing.T) {
 		t.Fatal("expected repository update to be called")
 	}
 }
+
+func TestServiceSearchRejectsBlankQuery(t *testing.T) {
+	svc := NewService(stubRepo{
+		searchFn: func(context.Context, string, int) ([]SearchResult, error) {
+			t.Fatal("repository should not be called for a blank query")
+			return nil, nil
+		},
+	})
+
+	if _, err := svc.Search(context.Background(), "   ", 0); !errors.Is(err, ErrEmptySearchQuery) {
+		t.Fatalf("expected ErrEmptySearchQuery, got %v", err)
+	}
+}
+
+func TestServicePurgeDeletedUsesRetentionCutoff(t *testing.T) {
+	var got time.Time
+	svc := NewService(stubRepo{
+		purgeFn: func(_ context.Context, before time.Time) (int64, error) {
+			got = before
+			return 3, nil
+		},
+	})
+
+	n, err := svc.PurgeDeleted(context.Background(), 24*time.Hour)
+	if err != nil || n != 3 {
+		t.Fatalf("unexpected result: %d, %v", n, err)
+	}
+	if want := time.Now().Add(-24 * time.Hour); got.Sub(want).Abs() > time.Minute {
+		t.Fatalf("expected cutoff near %v, got %v", want, got)
+	}
+}
+
+func TestServiceUpdateRecordsAuditDiff(t *testing.T) {
+	id := uuid.New()
+	newEmail := "jane.new@example.com"
+	var got AuditRecord
+	svc := NewService(stubRepo{
+		lockFn: func(context.Context, uuid.UUID, bool) (User, error) {
+			return User{UserID: id, FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Status: StatusActive}, nil
+		},
+		updateFn: func(context.Context, uuid.UUID, UpdateUserRequest, int64) (User, error) {
+			return User{UserID: id, FirstName: "Jane", LastName: "Doe", Email: newEmail, Status: StatusActive}, nil
+		},
+		auditFn: func(_ context.Context, rec AuditRecord) error {
+			got = rec
+			return nil
+		},
+	})
+
+	ctx := WithActor(context.Background(), "support@example.com")
+	if _, err := svc.Update(ctx, id, UpdateUserRequest{Email: &newEmail}, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.Action != AuditUpdate || got.Actor != "support@example.com" || got.UserID != id {
+		t.Fatalf("unexpected audit record: %+v", got)
+	}
+	if len(got.Changes) != 1 {
+		t.Fatalf("expected only email to change, got %+v", got.Changes)
+	}
+	change := got.Changes["email"]
+	if *change.Before.(*string) != "jane@example.com" || *change.After.(*string) != newEmail {
+		t.Fatalf("unexpected email change: %+v", change)
+	}
+}
+
+func TestServiceCreateFailsWhenAuditFails(t *testing.T) {
+	auditErr := errors.New("audit insert failed")
+	svc := NewService(stubRepo{
+		auditFn: func(context.Context, AuditRecord) error { return auditErr },
+	})
+
+	_, err := svc.Create(context.Background(), CreateUserRequest{FirstName: "John", LastName: "Doe", Email: "john@example.com"})
+	if !errors.Is(err, auditErr) {
+		t.Fatalf("expected audit error to abort the create, got %v", err)
+	}
+}
+
+func TestServiceBatchReportsRollbackInAtomicMode(t *testing.T) {
+	svc := NewService(stubRepo{
+		createFn: func(_ context.Context, input CreateUserRequest) (User, error) {
+			return User{UserID: uuid.New(), Email: input.Email}, nil
+		},
+	})
+	ops := []BatchOperation{
+		{Op: BatchCreate, Create: CreateUserRequest{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"}},
+		{Op: BatchCreate, Create: CreateUserRequest{FirstName: "Bad", LastName: "Email", Email: "not-an-email"}},
+	}
+
+	results, err := svc.Batch(context.Background(), ops, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(results[0].Err, ErrBatchRolledBack) || results[0].User != nil {
+		t.Fatalf("expected first item to be rolled back, got %+v", results[0])
+	}
+	if results[1].Err == nil || errors.Is(results[1].Err, ErrBatchRolledBack) {
+		t.Fatalf("expected validation error for second item, got %v", results[1].Err)
+	}
+
+	results, err = svc.Batch(context.Background(), ops, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Err != nil || results[0].User == nil || results[0].User.Email != "ada@example.com" {
+		t.Fatalf("expected first item to succeed in best-effort mode, got %+v", results[0])
+	}
+	if results[1].Err == nil {
+		t.Fatal("expected second item to fail in best-effort mode")
+	}
+}
@@ -0,0 +1,26 @@
+package user
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("go-crud/internal/user")
+
+// startSpan opens the span for one Service method. The returned function ends
+// it, recording the method's error; pass it the named error result in a
+// defer.
+func startSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, func(err *error)) {
+	ctx, span := tracer.Start(ctx, "user.Service/"+method, trace.WithAttributes(attrs...))
+	return ctx, func(err *error) {
+		if *err != nil {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+	}
+}
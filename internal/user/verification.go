@@ -0,0 +1,157 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go-crud/internal/mail"
+)
+
+// ErrInvalidVerificationToken covers unknown, used and expired tokens, and
+// tokens for an address the user no longer has.
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// EmailVerification is an outstanding token proving ownership of Email. Only
+// a SHA-256 hash of the token is stored.
+type EmailVerification struct {
+	UserID    uuid.UUID
+	Email     string
+	TokenHash []byte
+	ExpiresAt time.Time
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// WithEmailVerification sends a verification link through m whenever a user
+// is created or changes email. The link is link with the token added as the
+// token query parameter, and stays valid for ttl.
+func WithEmailVerification(m mail.Mailer, link string, ttl time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.mailer = m
+		s.verifyLink = link
+		s.verifyTTL = ttl
+	}
+}
+
+// outbox collects the emails of a transaction, to be sent once it commits.
+type outbox []mail.Message
+
+// VerifyEmail consumes a verification token and marks the address it was
+// sent to as verified. Tokens work once, whether or not they succeed.
+func (s *Service) VerifyEmail(ctx context.Context, req VerifyEmailRequest) (err error) {
+	ctx, end := startSpan(ctx, "VerifyEmail")
+	defer end(&err)
+
+	if err := s.validate.Struct(req); err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(req.Token))
+	v, err := s.repo.ConsumeEmailVerification(ctx, hash[:])
+	if err != nil {
+		return err
+	}
+	if time.Now().After(v.ExpiresAt) {
+		return fmt.Errorf("%w: expired", ErrInvalidVerificationToken)
+	}
+
+	return s.repo.WithTx(ctx, func(tx Repository) error {
+		before, err := tx.GetForUpdate(ctx, v.UserID, false)
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w: user not found", ErrInvalidVerificationToken)
+		}
+		if err != nil {
+			return err
+		}
+		if before.Email != v.Email {
+			return fmt.Errorf("%w: email has changed", ErrInvalidVerificationToken)
+		}
+		u, err := tx.MarkEmailVerified(ctx, v.UserID, v.Email)
+		if err != nil {
+			return err
+		}
+		return tx.RecordAudit(ctx, newAuditRecord(ctx, AuditEmailVerified, &before, u))
+	})
+}
+
+// PurgeEmailVerifications removes expired verification tokens.
+func (s *Service) PurgeEmailVerifications(ctx context.Context) (_ int64, err error) {
+	ctx, end := startSpan(ctx, "PurgeEmailVerifications")
+	defer end(&err)
+
+	return s.repo.PurgeEmailVerifications(ctx)
+}
+
+// requestVerification replaces u's verification token, using tx, and queues
+// the email carrying the new one in out.
+func (s *Service) requestVerification(ctx context.Context, tx Repository, u User, out *outbox) error {
+	if s.mailer == nil {
+		return nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	hash := sha256.Sum256([]byte(token))
+	link, err := url.Parse(s.verifyLink)
+	if err != nil {
+		return fmt.Errorf("verification link: %w", err)
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	err = tx.ReplaceEmailVerification(ctx, EmailVerification{
+		UserID:    u.UserID,
+		Email:     u.Email,
+		TokenHash: hash[:],
+		ExpiresAt: time.Now().Add(s.verifyTTL),
+	})
+	if err != nil {
+		return err
+	}
+	*out = append(*out, mail.Message{
+		To:      u.Email,
+		Subject: "Verify your email address",
+		Text: fmt.Sprintf("Hello %s,\n\nPlease confirm that this is your email address by opening the link below. It expires in %s.\n\n%s\n\nIf you did not expect this email, you can ignore it.\n",
+			u.FirstName, s.verifyTTL, link),
+	})
+	return nil
+}
+
+// send delivers the emails of a committed transaction. Failures are logged
+// rather than returned, since the change they describe has already been
+// committed.
+func (s *Service) send(ctx context.Context, out outbox) {
+	for _, msg := range out {
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			slog.ErrorContext(ctx, "send verification email", "error", err)
+		}
+	}
+}
+
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	if err := h.svc.VerifyEmail(r.Context(), req); err != nil {
+		handleRepoError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,202 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"go-crud/internal/mail"
+	"go-crud/internal/problem"
+)
+
+// tokenFromEmail extracts the token from the link in a verification email.
+func tokenFromEmail(t *testing.T, msg mail.Message) string {
+	t.Helper()
+	for _, line := range strings.Split(msg.Text, "\n") {
+		if u, err := url.Parse(line); err == nil && u.Query().Has("token") {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatalf("no verification link in %q", msg.Text)
+	return ""
+}
+
+func TestServiceCreateSendsVerification(t *testing.T) {
+	var stored []EmailVerification
+	repo := stubRepo{
+		createFn: func(_ context.Context, input CreateUserRequest) (User, error) {
+			return User{UserID: uuid.New(), FirstName: input.FirstName, Email: input.Email}, nil
+		},
+		replaceVerifyFn: func(_ context.Context, v EmailVerification) error {
+			stored = append(stored, v)
+			return nil
+		},
+	}
+	mailer := mail.NewMemoryMailer()
+	svc := NewService(repo, WithEmailVerification(mailer, "https://app.example.com/verify?lang=en", time.Hour))
+
+	u, err := svc.Create(context.Background(), CreateUserRequest{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	msgs := mailer.Messages()
+	if len(msgs) != 1 || msgs[0].To != "ada@example.com" || !strings.Contains(msgs[0].Text, "https://app.example.com/verify?lang=en&token=") {
+		t.Fatalf("unexpected emails %+v", msgs)
+	}
+	hash := sha256.Sum256([]byte(tokenFromEmail(t, msgs[0])))
+	if len(stored) != 1 || stored[0].UserID != u.UserID || stored[0].Email != u.Email || !bytes.Equal(stored[0].TokenHash, hash[:]) {
+		t.Fatalf("expected the token's hash to be stored, got %+v", stored)
+	}
+	if until := time.Until(stored[0].ExpiresAt); until <= 0 || until > time.Hour {
+		t.Fatalf("unexpected expiry %s", stored[0].ExpiresAt)
+	}
+}
+
+func TestServiceCreateDoesNotSendWhenRolledBack(t *testing.T) {
+	mailer := mail.NewMemoryMailer()
+	svc := NewService(stubRepo{
+		auditFn: func(context.Context, AuditRecord) error { return errors.New("audit down") },
+	}, WithEmailVerification(mailer, "https://app.example.com/verify", time.Hour))
+
+	if _, err := svc.Create(context.Background(), CreateUserRequest{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"}); err == nil {
+		t.Fatal("expected create to fail")
+	}
+	if msgs := mailer.Messages(); len(msgs) != 0 {
+		t.Fatalf("expected no email, got %+v", msgs)
+	}
+}
+
+func TestServiceUpdateSendsVerificationOnlyForNewEmail(t *testing.T) {
+	before := User{UserID: uuid.New(), FirstName: "Ada", Email: "ada@example.com"}
+	repo := stubRepo{
+		lockFn: func(context.Context, uuid.UUID, bool) (User, error) { return before, nil },
+		updateFn: func(_ context.Context, _ uuid.UUID, input UpdateUserRequest, _ int64) (User, error) {
+			u := before
+			if input.Email != nil {
+				u.Email = *input.Email
+			}
+			if input.Phone != nil {
+				u.Phone = *input.Phone
+			}
+			return u, nil
+		},
+	}
+	mailer := mail.NewMemoryMailer()
+	svc := NewService(repo, WithEmailVerification(mailer, "https://app.example.com/verify", time.Hour))
+
+	phone, same, other := "+14155552671", "ada@example.com", "ada@lovelace.org"
+	for _, input := range []UpdateUserRequest{{Phone: &phone}, {Email: &same}, {Email: &other}} {
+		if _, err := svc.Update(context.Background(), before.UserID, input, 0); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+	}
+	if msgs := mailer.Messages(); len(msgs) != 1 || msgs[0].To != other {
+		t.Fatalf("expected one email to the new address, got %+v", msgs)
+	}
+}
+
+func TestServiceBatchSendsVerificationOnlyOnCommit(t *testing.T) {
+	ops := []BatchOperation{
+		{Op: BatchCreate, Create: CreateUserRequest{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"}},
+		{Op: "merge"},
+	}
+	for _, atomic := range []bool{true, false} {
+		mailer := mail.NewMemoryMailer()
+		svc := NewService(stubRepo{
+			createFn: func(_ context.Context, input CreateUserRequest) (User, error) {
+				return User{UserID: uuid.New(), Email: input.Email}, nil
+			},
+		}, WithEmailVerification(mailer, "https://app.example.com/verify", time.Hour))
+
+		if _, err := svc.Batch(context.Background(), ops, atomic); err != nil {
+			t.Fatalf("batch: %v", err)
+		}
+		want := 1
+		if atomic {
+			want = 0
+		}
+		if got := len(mailer.Messages()); got != want {
+			t.Fatalf("atomic=%v: expected %d emails, got %d", atomic, want, got)
+		}
+	}
+}
+
+func TestServiceVerifyEmail(t *testing.T) {
+	id := uuid.New()
+	valid := EmailVerification{UserID: id, Email: "ada@example.com", ExpiresAt: time.Now().Add(time.Hour)}
+	tests := []struct {
+		name    string
+		v       EmailVerification
+		current string
+		wantErr bool
+	}{
+		{"valid", valid, "ada@example.com", false},
+		{"expired", EmailVerification{UserID: id, Email: "ada@example.com", ExpiresAt: time.Now().Add(-time.Minute)}, "ada@example.com", true},
+		{"email changed since", valid, "ada@lovelace.org", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var marked bool
+			var audited []string
+			svc := NewService(stubRepo{
+				consumeVerifyFn: func(context.Context, []byte) (EmailVerification, error) { return tt.v, nil },
+				lockFn: func(context.Context, uuid.UUID, bool) (User, error) {
+					return User{UserID: id, Email: tt.current}, nil
+				},
+				markVerifiedFn: func(_ context.Context, id uuid.UUID, email string) (User, error) {
+					marked = true
+					now := time.Now()
+					return User{UserID: id, Email: email, EmailVerifiedAt: &now}, nil
+				},
+				auditFn: func(_ context.Context, rec AuditRecord) error {
+					audited = append(audited, rec.Action)
+					return nil
+				},
+			})
+
+			err := svc.VerifyEmail(context.Background(), VerifyEmailRequest{Token: "token"})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidVerificationToken) || marked {
+					t.Fatalf("expected ErrInvalidVerificationToken without marking, got %v (marked %v)", err, marked)
+				}
+				return
+			}
+			if err != nil || !marked {
+				t.Fatalf("expected the email to be marked verified, got %v", err)
+			}
+			if len(audited) != 1 || audited[0] != AuditEmailVerified {
+				t.Fatalf("expected an email_verified audit record, got %v", audited)
+			}
+		})
+	}
+}
+
+func TestVerifyEmailReportsInvalidToken(t *testing.T) {
+	r := chi.NewRouter()
+	NewHandler(NewService(stubRepo{})).RegisterPublicRoutes(r)
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/users/verify-email", strings.NewReader(`{"token":"unknown"}`)))
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", res.Code, res.Body)
+	}
+	var got problem.Problem
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Code != "invalid_verification_token" {
+		t.Fatalf("unexpected problem: %+v", got)
+	}
+}
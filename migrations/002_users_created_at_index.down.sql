@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_users_created_at_user_id;
@@ -0,0 +1,8 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_users_search_tsv ON users
+    USING GIN (to_tsvector('simple', first_name || ' ' || last_name || ' ' || email));
+CREATE INDEX IF NOT EXISTS idx_users_full_name_trgm ON users
+    USING GIN ((first_name || ' ' || last_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users
+    USING GIN (email gin_trgm_ops);
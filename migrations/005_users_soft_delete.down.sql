@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_users_deleted_at;
+
+-- Emails are unique again across all rows, so soft-deleted users must go.
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS users_email_live_key;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
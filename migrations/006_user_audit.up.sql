@@ -0,0 +1,13 @@
+-- Audit rows outlive purged users, so user_id deliberately has no foreign key.
+CREATE TABLE IF NOT EXISTS user_audit (
+    audit_id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    actor TEXT NOT NULL,
+    request_id TEXT,
+    changes JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_audit_user_id ON user_audit (user_id, created_at DESC, audit_id DESC);
+CREATE INDEX IF NOT EXISTS idx_user_audit_created_at ON user_audit (created_at DESC, audit_id DESC);
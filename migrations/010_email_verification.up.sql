@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+-- Tokens are single-use and stored hashed. Each names the address it
+-- verifies, so a token sent before an email change cannot verify the new one.
+CREATE TABLE IF NOT EXISTS email_verifications (
+    token_hash BYTEA PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_verifications_user_id ON email_verifications (user_id);
+CREATE INDEX IF NOT EXISTS idx_email_verifications_expires_at ON email_verifications (expires_at);
@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL schema migrations. Each version NNN has an
+// NNN_name.up.sql file and an NNN_name.down.sql file that reverts it.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS